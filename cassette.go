@@ -0,0 +1,172 @@
+package spy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+)
+
+var ErrNotInCassette = errors.New("request not in cassette")
+
+type CassetteMode int
+
+const (
+	// CassetteReplay serves the responses from the cassette, and fails on unknown requests.
+	CassetteReplay CassetteMode = iota
+	// CassetteRecord fetches the requests with a handler, and records the responses into the cassette.
+	CassetteRecord
+)
+
+// CassetteFetcherHandler records the responses fetched during a crawl into a cassette file,
+// or replays them from it, so that spiders can be tested against the pages as they were.
+// The cassette is a JSON lines file, one exchange per line, keyed by the fingerprint of the request,
+// see Request.Fingerprint.
+// Register it for the schemes it should record or replay, e.g.:
+//
+//	cassette, err := NewCassetteRecorder("crawl.jsonl", NewHTTPFetcherHandler())
+//	fetcher.RegisterHandler("http", cassette)
+//	fetcher.RegisterHandler("https", cassette)
+type CassetteFetcherHandler struct {
+	Mode    CassetteMode
+	Handler FetcherHandler // fetches the requests when recording
+
+	episodes map[string]*cassetteEpisode
+	file     *os.File
+	mutex    sync.Mutex
+}
+
+type cassetteEpisode struct {
+	Key        string      `json:"key"`
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	Status     string      `json:"status"`
+	StatusCode int         `json:"status_code"`
+	Proto      string      `json:"proto"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+}
+
+// NewCassetteRecorder creates the cassette file, truncating it, and records the responses fetched by the handler.
+func NewCassetteRecorder(filename string, handler FetcherHandler) (*CassetteFetcherHandler, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &CassetteFetcherHandler{
+		Mode:     CassetteRecord,
+		Handler:  handler,
+		episodes: make(map[string]*cassetteEpisode),
+		file:     file,
+	}, nil
+}
+
+// NewCassettePlayer loads the cassette file to replay it.
+func NewCassettePlayer(filename string) (*CassetteFetcherHandler, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	ch := &CassetteFetcherHandler{
+		Mode:     CassetteReplay,
+		episodes: make(map[string]*cassetteEpisode),
+	}
+	reader := bufio.NewReader(file)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(data)) > 0 {
+			episode := &cassetteEpisode{}
+			if err := json.Unmarshal(data, episode); err != nil {
+				return nil, fmt.Errorf("cassette %s, line %d: %s", filename, line, err)
+			}
+			ch.episodes[episode.Key] = episode // the last recording wins
+		}
+		if err == io.EOF {
+			return ch, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (ch *CassetteFetcherHandler) Fetch(request *Request, spider ISpider) (*Response, error) {
+	key := request.Fingerprint()
+
+	if ch.Mode == CassetteReplay {
+		ch.mutex.Lock()
+		episode, ok := ch.episodes[key]
+		ch.mutex.Unlock()
+		if !ok {
+			return nil, fmt.Errorf("%w: %s %s", ErrNotInCassette, request.Method, request.URL)
+		}
+		return episode.response(request)
+	}
+
+	response, err := ch.Handler.Fetch(request, spider)
+	if err != nil {
+		return nil, err
+	}
+	episode := &cassetteEpisode{
+		Key:        key,
+		Method:     request.Method,
+		URL:        request.URL.String(),
+		Status:     response.Status,
+		StatusCode: response.StatusCode,
+		Proto:      response.Proto,
+		Header:     response.Response.Header,
+		Body:       response.RawBody(),
+	}
+	return response, ch.record(episode)
+}
+
+func (ch *CassetteFetcherHandler) record(episode *cassetteEpisode) error {
+	line, err := json.Marshal(episode)
+	if err != nil {
+		return err
+	}
+
+	ch.mutex.Lock()
+	defer ch.mutex.Unlock()
+	if ch.file == nil {
+		return errors.New("cassette closed")
+	}
+	ch.episodes[episode.Key] = episode
+	_, err = ch.file.Write(append(line, '\n'))
+	return err
+}
+
+// Close closes the cassette file, and the handler when recording.
+func (ch *CassetteFetcherHandler) Close() {
+	ch.mutex.Lock()
+	file := ch.file
+	ch.file = nil
+	ch.mutex.Unlock()
+
+	if file != nil { // the same handler may be registered for several schemes
+		file.Close()
+		ch.Handler.Close()
+	}
+}
+
+func (e *cassetteEpisode) response(request *Request) (*Response, error) {
+	hr := &http.Response{
+		Status:        e.Status,
+		StatusCode:    e.StatusCode,
+		Proto:         e.Proto,
+		Header:        e.Header.Clone(), // callbacks may modify it, and replays may run concurrently
+		Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       request.Request,
+	}
+	hr.ProtoMajor, hr.ProtoMinor, _ = http.ParseHTTPVersion(e.Proto)
+	return NewResponse(hr)
+}
@@ -0,0 +1,207 @@
+// Package cli implements the spy command-line tool.
+//
+// Spiders register themselves with spy.Register, so a project builds its own tool
+// by importing its spiders and calling Main:
+//
+//	package main
+//
+//	import (
+//		"github.com/ridewindx/spy/cli"
+//		_ "example.com/project/spiders"
+//	)
+//
+//	func main() {
+//		cli.Main()
+//	}
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/ridewindx/spy"
+	"github.com/spf13/viper"
+	"io"
+	"os"
+	"strings"
+)
+
+// App is the command-line tool of the spiders of a SpiderLoader.
+type App struct {
+	Name      string
+	Loader    *spy.SpiderLoader
+	Contracts *spy.ContractRegistry
+
+	// Config is the base config of the crawlers, overridden by the -s flags.
+	Config *spy.Config
+
+	// NewCrawler assembles the crawler of a spider, spy.NewDefaultCrawler by default.
+	// Projects set it to add their middlewares, pipelines and extensions.
+	NewCrawler func(spider spy.ISpider, config *spy.Config) *spy.Crawler
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// NewApp returns the tool of the spiders registered with spy.Register.
+func NewApp() *App {
+	return &App{
+		Name:       "spy",
+		Loader:     spy.DefaultSpiderLoader,
+		Contracts:  spy.DefaultContractRegistry,
+		NewCrawler: spy.NewDefaultCrawler,
+		Stdin:      os.Stdin,
+		Stdout:     os.Stdout,
+		Stderr:     os.Stderr,
+	}
+}
+
+// Main runs the tool with the command-line arguments, and exits.
+func Main() {
+	os.Exit(NewApp().Run(os.Args[1:]))
+}
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(app *App, args []string) error
+}
+
+var commands = []*command{
+	{"crawl", "[-s key=value]... [-o file] <spider>", "Run a spider", runCrawl},
+	{"list", "", "List the spiders", runList},
+	{"fetch", "[-s key=value]... [--spider name] [--headers] <url>", "Fetch a URL through the fetcher", runFetch},
+	{"parse", "[-s key=value]... [--spider name] [--callback name] <url>", "Parse a URL with a spider callback", runParse},
+	{"check", "[-s key=value]... [--offline] [--fixtures dir] [spider...]", "Check the contracts of spiders", runCheck},
+	{"shell", "[-s key=value]... [--spider name] <url|file>", "Explore a response interactively", runShell},
+	{"version", "", "Print the version", runVersion},
+}
+
+// errUsage makes Run print the usage of the command.
+var errUsage = errors.New("invalid usage")
+
+// Run runs the command of the arguments, and returns the exit status.
+func (app *App) Run(args []string) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		app.usage()
+		return 2
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+		err := cmd.run(app, args[1:])
+		switch {
+		case err == nil:
+			return 0
+		case errors.Is(err, errUsage) || errors.Is(err, flag.ErrHelp):
+			fmt.Fprintf(app.Stderr, "usage: %s %s %s\n", app.Name, cmd.name, cmd.args)
+			return 2
+		default:
+			fmt.Fprintf(app.Stderr, "%s %s: %s\n", app.Name, cmd.name, err)
+			return 1
+		}
+	}
+
+	fmt.Fprintf(app.Stderr, "%s: unknown command %q\n", app.Name, args[0])
+	app.usage()
+	return 2
+}
+
+func (app *App) usage() {
+	fmt.Fprintf(app.Stderr, "usage: %s <command> [arguments]\n\ncommands:\n", app.Name)
+	for _, cmd := range commands {
+		fmt.Fprintf(app.Stderr, "  %-8s %s\n", cmd.name, cmd.summary)
+	}
+}
+
+// newFlagSet returns a flag set writing its errors to the app, with the -s flag.
+func (app *App) newFlagSet(name string, settings *settingsFlag) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(app.Stderr)
+	fs.Var(settings, "s", "set a setting, as key=value, can be repeated")
+	return fs
+}
+
+// parseArgs parses the flags, even after positional arguments, and returns the positional arguments.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// settingsFlag collects key=value settings.
+type settingsFlag [][2]string
+
+func (s *settingsFlag) String() string {
+	pairs := make([]string, len(*s))
+	for i, kv := range *s {
+		pairs[i] = kv[0] + "=" + kv[1]
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (s *settingsFlag) Set(value string) error {
+	i := strings.Index(value, "=")
+	if i <= 0 {
+		return fmt.Errorf("invalid setting %q, expected key=value", value)
+	}
+	*s = append(*s, [2]string{value[:i], value[i+1:]})
+	return nil
+}
+
+// newConfig returns a copy of the base config, with the settings.
+func (app *App) newConfig(settings settingsFlag) *spy.Config {
+	config := &spy.Config{}
+	if app.Config != nil {
+		*config = *app.Config
+	}
+	config.Viper = viper.New()
+	if app.Config != nil && app.Config.Viper != nil {
+		for _, key := range app.Config.AllKeys() {
+			config.Set(key, app.Config.Get(key))
+		}
+	}
+	for _, kv := range settings {
+		config.Set(kv[0], kv[1])
+	}
+	return config
+}
+
+// newCrawler returns the crawler of the spider, or of a default spider if nil.
+func (app *App) newCrawler(spider spy.ISpider, settings settingsFlag) *spy.Crawler {
+	if spider == nil {
+		spider = &defaultSpider{}
+	}
+	return app.NewCrawler(spider, app.newConfig(settings))
+}
+
+// spiderFor returns the spider with the name, or else the one handling the URL, if any.
+func (app *App) spiderFor(name, rawurl string) (spy.ISpider, error) {
+	if name != "" {
+		return app.Loader.Load(name)
+	}
+	if rawurl == "" {
+		return nil, nil
+	}
+	names, err := app.Loader.FindByURL(rawurl)
+	if err != nil || len(names) == 0 {
+		return nil, err
+	}
+	if len(names) > 1 {
+		return nil, fmt.Errorf("several spiders handle %s: %s, choose one with --spider", rawurl, strings.Join(names, ", "))
+	}
+	return app.Loader.Load(names[0])
+}
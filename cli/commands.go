@@ -0,0 +1,316 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ridewindx/spy"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+func runCrawl(app *App, args []string) error {
+	var settings settingsFlag
+	fs := app.newFlagSet("crawl", &settings)
+	output := fs.String("o", "", "write the scraped items to the file as JSON lines, - for stdout")
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	spider, err := app.Loader.Load(args[0])
+	if err != nil {
+		return err
+	}
+	crawler := app.newCrawler(spider, settings)
+
+	if *output != "" {
+		feed, err := newFeed(*output, app.Stdout)
+		if err != nil {
+			return err
+		}
+		defer feed.Close()
+		if _, err = crawler.Events.OnItemScraped(feed.itemScraped); err != nil {
+			return err
+		}
+	}
+
+	return crawler.Run(context.Background())
+}
+
+func runList(app *App, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	for _, name := range app.Loader.List() {
+		fmt.Fprintln(app.Stdout, name)
+	}
+	return nil
+}
+
+func runFetch(app *App, args []string) error {
+	var settings settingsFlag
+	fs := app.newFlagSet("fetch", &settings)
+	spiderName := fs.String("spider", "", "fetch as the spider, instead of the one handling the URL")
+	headers := fs.Bool("headers", false, "print the status and the headers instead of the body")
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	spider, err := app.spiderFor(*spiderName, args[0])
+	if err != nil {
+		return err
+	}
+	crawler := app.newCrawler(spider, settings)
+	defer crawler.Fetcher.Close(crawler.Spider)
+
+	response, err := fetchURL(crawler, args[0])
+	if err != nil {
+		return err
+	}
+
+	if *headers {
+		fmt.Fprintf(app.Stdout, "%s %s\n", response.Proto, response.Status)
+		return response.Response.Header.Write(app.Stdout)
+	}
+	_, err = app.Stdout.Write(response.RawBody())
+	return err
+}
+
+func runParse(app *App, args []string) error {
+	var settings settingsFlag
+	fs := app.newFlagSet("parse", &settings)
+	spiderName := fs.String("spider", "", "parse with the spider, instead of the one handling the URL")
+	callbackName := fs.String("callback", "Parse", "the method of the spider parsing the response")
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	spider, err := app.spiderFor(*spiderName, args[0])
+	if err != nil {
+		return err
+	}
+	if spider == nil {
+		return fmt.Errorf("no spider handles %s, choose one with --spider", args[0])
+	}
+	callback, err := spy.SpiderCallback(spider, *callbackName)
+	if err != nil {
+		return err
+	}
+
+	crawler := app.newCrawler(spider, settings)
+	defer crawler.Fetcher.Close(crawler.Spider)
+
+	response, err := fetchURL(crawler, args[0])
+	if err != nil {
+		return err
+	}
+	result, err := callback(response)
+	if err != nil {
+		return err
+	}
+	return printResult(app.Stdout, result)
+}
+
+func runCheck(app *App, args []string) error {
+	var settings settingsFlag
+	fs := app.newFlagSet("check", &settings)
+	offline := fs.Bool("offline", false, "parse the @fixture files instead of fetching the @url")
+	fixtureDir := fs.String("fixtures", ".", "the directory of the @fixture files")
+	spiders, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(spiders) == 0 {
+		spiders = app.Contracts.Spiders()
+	}
+
+	failed := 0
+	for _, name := range spiders {
+		spider, err := app.Loader.Load(name)
+		if err != nil {
+			return err
+		}
+		crawler := app.newCrawler(spider, settings)
+		checker := &spy.ContractChecker{
+			Registry:   app.Contracts,
+			Offline:    *offline,
+			FixtureDir: *fixtureDir,
+			Fetch: func(rawurl string) (*spy.Response, error) {
+				return fetchURL(crawler, rawurl)
+			},
+		}
+
+		for _, result := range checker.Check(spider) {
+			if result.OK() {
+				fmt.Fprintf(app.Stdout, "OK   %s %s\n", result.Contract, result.Contract.URL)
+				continue
+			}
+			failed++
+			fmt.Fprintf(app.Stdout, "FAIL %s %s\n", result.Contract, result.Contract.URL)
+			for _, err := range result.Errors {
+				fmt.Fprintf(app.Stdout, "     %s\n", err)
+			}
+		}
+		crawler.Fetcher.Close(spider)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d contracts failed", failed)
+	}
+	return nil
+}
+
+func runVersion(app *App, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	fmt.Fprintf(app.Stdout, "%s %s\n", app.Name, spy.Version)
+	return nil
+}
+
+const maxRedirects = 10
+
+// fetchURL fetches the URL through the fetcher of the crawler, following the returned requests.
+func fetchURL(crawler *spy.Crawler, rawurl string) (*spy.Response, error) {
+	request := spy.NewRequest(rawurl, http.MethodGet)
+	for i := 0; i <= maxRedirects; i++ {
+		if request.Error != nil {
+			return nil, request.Error
+		}
+		response, next, err := crawler.Fetcher.Fetch(request, crawler.Spider)
+		if err != nil {
+			return nil, err
+		}
+		if response != nil {
+			response.Request = request
+			return response, nil
+		}
+		request = next
+	}
+	return nil, fmt.Errorf("more than %d redirections", maxRedirects)
+}
+
+func printResult(w io.Writer, result *spy.SpiderResult) error {
+	if result == nil {
+		result = &spy.SpiderResult{}
+	}
+
+	fmt.Fprintf(w, "# Scraped items (%d)\n", len(result.Items))
+	for _, item := range result.Items {
+		line, err := itemJSON(item)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\n", line)
+	}
+
+	fmt.Fprintf(w, "# Requests (%d)\n", len(result.Requests))
+	for _, request := range result.Requests {
+		if request.Request == nil {
+			fmt.Fprintf(w, "invalid request: %s\n", request.Error)
+			continue
+		}
+		fmt.Fprintf(w, "%s %s\n", request.Method, request.URL)
+	}
+	return nil
+}
+
+// itemJSON marshals the fields of the item, see spy.ItemAdapter.
+func itemJSON(item interface{}) ([]byte, error) {
+	adapter, err := spy.NewItemAdapter(item)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]interface{})
+	for _, field := range adapter.Fields() {
+		if value, ok := adapter.Get(field); ok {
+			fields[field] = value
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// feed writes the scraped items as JSON lines.
+type feed struct {
+	w      io.Writer
+	closer io.Closer
+	mutex  sync.Mutex
+}
+
+func newFeed(filename string, stdout io.Writer) (*feed, error) {
+	if filename == "-" {
+		return &feed{w: stdout}, nil
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &feed{w: file, closer: file}, nil
+}
+
+func (f *feed) itemScraped(spider spy.ISpider, response *spy.Response, item interface{}) error {
+	line, err := itemJSON(item)
+	if err != nil {
+		return err
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	_, err = f.w.Write(append(line, '\n'))
+	return err
+}
+
+func (f *feed) Close() error {
+	if f.closer == nil {
+		return nil
+	}
+	return f.closer.Close()
+}
+
+// defaultSpider fetches the URLs which no registered spider handles.
+type defaultSpider struct {
+	crawler *spy.Crawler
+}
+
+func (s *defaultSpider) StartRequests() []*spy.Request {
+	return nil
+}
+
+func (s *defaultSpider) Parse(response *spy.Response) (*spy.SpiderResult, error) {
+	return nil, errors.New("the default spider doesn't parse responses")
+}
+
+func (s *defaultSpider) FetchDelay() time.Duration {
+	return 0
+}
+
+func (s *defaultSpider) ConcurrentRequests() int {
+	return 0
+}
+
+func (s *defaultSpider) String() string {
+	return "default"
+}
+
+func (s *defaultSpider) Crawler() *spy.Crawler {
+	return s.crawler
+}
+
+func (s *defaultSpider) SetCrawler(crawler *spy.Crawler) {
+	s.crawler = crawler
+}
@@ -0,0 +1,251 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/ridewindx/spy"
+	"io/ioutil"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const shellHelp = `Queries select from the response, and print the extracted texts:
+  css <query>              select with CSS, e.g., css a::attr(href)
+  xpath <query>            select with XPath
+Queries can be chained with |, and end with one of:
+  re <pattern>             extract the matches of the regular expression
+  attr <name>              extract the attribute
+  html | outer             extract the inner or outer HTML
+  first                    extract the first text only
+  count                    print the number of selected nodes
+e.g., css div.product | xpath .//h2 | first
+
+Commands:
+  fetch <url|file>         fetch another response
+  response                 print the status and the headers of the response
+  view                     save the response to a local file, and print its path
+  help                     print this help
+  quit                     exit, also on EOF
+`
+
+func runShell(app *App, args []string) error {
+	var settings settingsFlag
+	fs := app.newFlagSet("shell", &settings)
+	spiderName := fs.String("spider", "", "fetch as the spider, instead of the one handling the URL")
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	var spider spy.ISpider
+	if !isFile(args[0]) {
+		if spider, err = app.spiderFor(*spiderName, args[0]); err != nil {
+			return err
+		}
+	}
+	crawler := app.newCrawler(spider, settings)
+	defer crawler.Fetcher.Close(crawler.Spider)
+
+	sh := &shell{app: app, crawler: crawler}
+	if err = sh.fetch(args[0]); err != nil {
+		return err
+	}
+	fmt.Fprintf(app.Stdout, "[spy] response bound to %s, type help for the commands\n", sh.response.Request.URL)
+	return sh.loop()
+}
+
+type shell struct {
+	app      *App
+	crawler  *spy.Crawler
+	response *spy.Response
+}
+
+func (sh *shell) loop() error {
+	scanner := bufio.NewScanner(sh.app.Stdin)
+	for {
+		fmt.Fprint(sh.app.Stdout, ">>> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(sh.app.Stdout)
+			return scanner.Err()
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if line == "quit" || line == "exit" {
+			return nil
+		}
+		if err := sh.eval(line); err != nil {
+			fmt.Fprintf(sh.app.Stdout, "error: %s\n", err)
+		}
+	}
+}
+
+func (sh *shell) eval(line string) (err error) {
+	defer func() {
+		if r := recover(); r != nil { // invalid queries panic
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	name, arg := splitWord(line)
+	switch name {
+	case "help":
+		fmt.Fprint(sh.app.Stdout, shellHelp)
+	case "fetch":
+		if arg == "" {
+			return fmt.Errorf("usage: fetch <url|file>")
+		}
+		return sh.fetch(arg)
+	case "response":
+		r := sh.response
+		fmt.Fprintf(sh.app.Stdout, "%s %s %s\n", r.Proto, r.Status, r.Request.URL)
+		return r.Response.Header.Write(sh.app.Stdout)
+	case "view":
+		return sh.view()
+	case "css", "xpath":
+		return sh.query(line)
+	default:
+		return fmt.Errorf("unknown command %q, type help for the commands", name)
+	}
+	return nil
+}
+
+// query evaluates a chain of steps separated by |, a | not followed by a step belonging to an XPath union.
+func (sh *shell) query(line string) error {
+	var steps []string
+	for _, part := range strings.Split(line, "|") {
+		word, _ := splitWord(strings.TrimSpace(part))
+		if len(steps) > 0 && !isShellStep(word) {
+			steps[len(steps)-1] += "|" + part
+			continue
+		}
+		steps = append(steps, strings.TrimSpace(part))
+	}
+
+	selectors := spy.Selectors{sh.response.Selector()}
+	if selectors[0] == nil {
+		return fmt.Errorf("the response is neither HTML nor XML")
+	}
+
+	for i, step := range steps {
+		name, arg := splitWord(step)
+		last := i == len(steps)-1
+		switch name {
+		case "css":
+			selectors = selectors.Select(strings.TrimSpace(arg))
+			if last {
+				sh.print(selectors.Extract())
+			}
+			continue
+		case "xpath":
+			selectors = selectors.XPath(strings.TrimSpace(arg))
+			if last {
+				sh.print(selectors.Extract())
+			}
+			continue
+		}
+
+		if !last {
+			return fmt.Errorf("%s must be the last step", name)
+		}
+		switch name {
+		case "re":
+			sh.print(selectors.Regex(strings.TrimSpace(arg)))
+		case "attr":
+			sh.print(selectors.Attrs(strings.TrimSpace(arg)))
+		case "html":
+			sh.print(selectors.ExtractHTML())
+		case "outer":
+			sh.print(selectors.ExtractOuterHTML())
+		case "first":
+			fmt.Fprintf(sh.app.Stdout, "%q\n", selectors.ExtractFirst())
+		case "count":
+			fmt.Fprintln(sh.app.Stdout, len(selectors))
+		}
+	}
+	return nil
+}
+
+func isShellStep(word string) bool {
+	switch word {
+	case "css", "xpath", "re", "attr", "html", "outer", "first", "count":
+		return true
+	}
+	return false
+}
+
+func (sh *shell) print(texts []string) {
+	for i, text := range texts {
+		fmt.Fprintf(sh.app.Stdout, "[%d] %q\n", i, text)
+	}
+	if len(texts) == 0 {
+		fmt.Fprintln(sh.app.Stdout, "[]")
+	}
+}
+
+func (sh *shell) fetch(target string) error {
+	var response *spy.Response
+	var err error
+	if isFile(target) {
+		response, err = loadFile(target)
+	} else {
+		response, err = fetchURL(sh.crawler, target)
+	}
+	if err != nil {
+		return err
+	}
+	sh.response = response
+	return nil
+}
+
+// view saves the body of the response to a temporary file, with an extension of its media type.
+func (sh *shell) view() error {
+	ext := ".html"
+	if exts, _ := mime.ExtensionsByType(sh.response.MediaType); len(exts) > 0 && sh.response.MediaType != spy.MIMEHTML {
+		ext = exts[0]
+	}
+	file, err := ioutil.TempFile("", "spy-*"+ext)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err = file.Write(sh.response.RawBody()); err != nil {
+		return err
+	}
+	fmt.Fprintf(sh.app.Stdout, "file://%s\n", filepath.ToSlash(file.Name()))
+	return nil
+}
+
+// isFile returns whether the target is an existing file rather than a URL.
+func isFile(target string) bool {
+	if strings.Contains(target, "://") {
+		return false
+	}
+	info, err := os.Stat(target)
+	return err == nil && !info.IsDir()
+}
+
+// loadFile returns a response of the file, with a file URL.
+func loadFile(filename string) (*spy.Response, error) {
+	path, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	u := &url.URL{Scheme: "file", Path: filepath.ToSlash(path)}
+	return spy.NewFileResponse(u.String(), path)
+}
+
+// splitWord splits the first word of the line from the rest.
+func splitWord(line string) (word, rest string) {
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		return line[:i], line[i+1:]
+	}
+	return line, ""
+}
@@ -0,0 +1,105 @@
+package spy
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Finish reasons of the CloseSpider extension.
+const (
+	FinishReasonTimeout    = "closespider_timeout"
+	FinishReasonItemCount  = "closespider_itemcount"
+	FinishReasonPageCount  = "closespider_pagecount"
+	FinishReasonErrorCount = "closespider_errorcount"
+)
+
+// CloseSpider is a crawler extension which closes the spider when a threshold is reached:
+// a timeout since the spider opened, or a number of items scraped, responses received or spider errors.
+// The thresholds are read from the config of the crawler, zero disables them.
+type CloseSpider struct {
+	Timeout    time.Duration
+	ItemCount  int64
+	PageCount  int64
+	ErrorCount int64
+
+	crawler *Crawler
+	subs    []*Subscription
+	timer   *time.Timer
+	items   int64
+	pages   int64
+	errors  int64
+}
+
+func NewCloseSpider(crawler *Crawler) *CloseSpider {
+	cs := &CloseSpider{
+		crawler: crawler,
+	}
+	if config := crawler.Config; config != nil && config.Viper != nil {
+		cs.Timeout = time.Duration(config.GetFloat64(CloseSpiderTimeout) * float64(time.Second))
+		cs.ItemCount = config.GetInt64(CloseSpiderItemCount)
+		cs.PageCount = config.GetInt64(CloseSpiderPageCount)
+		cs.ErrorCount = config.GetInt64(CloseSpiderErrorCount)
+	}
+	return cs
+}
+
+func (cs *CloseSpider) Open(spider ISpider) {
+	atomic.StoreInt64(&cs.items, 0)
+	atomic.StoreInt64(&cs.pages, 0)
+	atomic.StoreInt64(&cs.errors, 0)
+
+	events := cs.crawler.Events
+	if cs.ItemCount > 0 {
+		cs.subscribe(events.OnItemScraped(cs.itemScraped))
+	}
+	if cs.PageCount > 0 {
+		cs.subscribe(events.OnResponseReceived(cs.responseReceived))
+	}
+	if cs.ErrorCount > 0 {
+		cs.subscribe(events.OnSpiderError(cs.spiderError))
+	}
+	if cs.Timeout > 0 {
+		cs.timer = time.AfterFunc(cs.Timeout, func() {
+			cs.crawler.CloseSpider(FinishReasonTimeout)
+		})
+	}
+}
+
+func (cs *CloseSpider) Close(spider ISpider) {
+	cs.crawler.Events.UnsubAll(cs.subs...)
+	cs.subs = nil
+
+	if cs.timer != nil {
+		cs.timer.Stop()
+		cs.timer = nil
+	}
+}
+
+func (cs *CloseSpider) subscribe(sub *Subscription, err error) {
+	if err != nil {
+		cs.crawler.Logger.WithError(err).WithField("spider", cs.crawler.Spider.String()).Error("Subscribing close spider")
+		return
+	}
+	cs.subs = append(cs.subs, sub)
+}
+
+func (cs *CloseSpider) itemScraped(spider ISpider, response *Response, item interface{}) error {
+	if atomic.AddInt64(&cs.items, 1) == cs.ItemCount {
+		cs.crawler.CloseSpider(FinishReasonItemCount)
+	}
+	return nil
+}
+
+func (cs *CloseSpider) responseReceived(spider ISpider, request *Request, response *Response) error {
+	if atomic.AddInt64(&cs.pages, 1) == cs.PageCount {
+		cs.crawler.CloseSpider(FinishReasonPageCount)
+	}
+	return nil
+}
+
+func (cs *CloseSpider) spiderError(spider ISpider, response *Response, err error) error {
+	if atomic.AddInt64(&cs.errors, 1) == cs.ErrorCount {
+		cs.crawler.CloseSpider(FinishReasonErrorCount)
+	}
+	return nil
+}
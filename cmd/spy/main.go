@@ -0,0 +1,8 @@
+// Command spy is the spy command-line tool, see package cli.
+package main
+
+import "github.com/ridewindx/spy/cli"
+
+func main() {
+	cli.Main()
+}
@@ -13,3 +13,11 @@ type Config struct {
 }
 
 const ItemPipelines = "ItemPipelines"
+
+// Settings of the CloseSpider extension, zero disables them.
+const (
+	CloseSpiderTimeout    = "CloseSpiderTimeout" // seconds
+	CloseSpiderItemCount  = "CloseSpiderItemCount"
+	CloseSpiderPageCount  = "CloseSpiderPageCount"
+	CloseSpiderErrorCount = "CloseSpiderErrorCount"
+)
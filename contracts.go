@@ -0,0 +1,283 @@
+package spy
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CallbackContract declares the expected result of a callback of a spider on a URL,
+// from annotations, one per line:
+//
+//	@url http://example.com/products/1    the URL to parse, required
+//	@fixture products/1.html              the file parsed instead of the URL, offline
+//	@returns items 1 10                   between 1 and 10 items; the maximum is optional
+//	@returns requests 0 0                 no request
+//	@scrapes name price                   every item has the fields, not zero
+type CallbackContract struct {
+	Spider   string
+	Callback string
+	URL      string
+	Fixture  string
+	Returns  []ReturnsContract
+	Scrapes  []string
+}
+
+// ReturnsContract bounds the number of items or requests returned by a callback.
+type ReturnsContract struct {
+	Kind string // "items" or "requests"
+	Min  int
+	Max  int // negative if unbounded
+}
+
+// ParseContract parses the annotations of the callback of the spider.
+func ParseContract(spider, callback, annotations string) (*CallbackContract, error) {
+	cc := &CallbackContract{
+		Spider:   spider,
+		Callback: callback,
+	}
+
+	for _, line := range strings.Split(annotations, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		args := fields[1:]
+		switch fields[0] {
+		case "@url":
+			if len(args) != 1 {
+				return nil, fmt.Errorf("@url expects a URL: %q", line)
+			}
+			cc.URL = args[0]
+		case "@fixture":
+			if len(args) != 1 {
+				return nil, fmt.Errorf("@fixture expects a file: %q", line)
+			}
+			cc.Fixture = args[0]
+		case "@returns":
+			rc, err := parseReturns(args)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %q", err, line)
+			}
+			cc.Returns = append(cc.Returns, rc)
+		case "@scrapes":
+			if len(args) == 0 {
+				return nil, fmt.Errorf("@scrapes expects fields: %q", line)
+			}
+			cc.Scrapes = append(cc.Scrapes, args...)
+		default:
+			return nil, fmt.Errorf("unknown annotation: %q", line)
+		}
+	}
+
+	if cc.URL == "" {
+		return nil, errors.New("missing @url")
+	}
+	return cc, nil
+}
+
+func parseReturns(args []string) (ReturnsContract, error) {
+	rc := ReturnsContract{Max: -1}
+	if len(args) < 2 || len(args) > 3 || (args[0] != "items" && args[0] != "requests") {
+		return rc, errors.New("@returns expects items or requests, a minimum and an optional maximum")
+	}
+	rc.Kind = args[0]
+
+	var err error
+	if rc.Min, err = strconv.Atoi(args[1]); err != nil {
+		return rc, err
+	}
+	if len(args) == 3 {
+		if rc.Max, err = strconv.Atoi(args[2]); err != nil {
+			return rc, err
+		}
+	}
+	return rc, nil
+}
+
+func (cc *CallbackContract) String() string {
+	return cc.Spider + "." + cc.Callback
+}
+
+// Check returns the violations of the contract by the result of the callback.
+func (cc *CallbackContract) Check(result *SpiderResult) []error {
+	if result == nil {
+		result = &SpiderResult{}
+	}
+
+	var errs []error
+	for _, rc := range cc.Returns {
+		n := len(result.Items)
+		if rc.Kind == "requests" {
+			n = len(result.Requests)
+		}
+		if n < rc.Min || (rc.Max >= 0 && n > rc.Max) {
+			bounds := strconv.Itoa(rc.Min) + ".."
+			if rc.Max >= 0 {
+				bounds += strconv.Itoa(rc.Max)
+			}
+			errs = append(errs, fmt.Errorf("returned %d %s, expected %s", n, rc.Kind, bounds))
+		}
+	}
+
+	for i, item := range result.Items {
+		adapter, err := NewItemAdapter(item)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("item %d: %s", i, err))
+			continue
+		}
+		var missing []string
+		for _, field := range cc.Scrapes {
+			if fieldMissing(adapter, field) {
+				missing = append(missing, field)
+			}
+		}
+		if len(missing) > 0 {
+			errs = append(errs, fmt.Errorf("item %d misses %s", i, strings.Join(missing, ", ")))
+		}
+	}
+	return errs
+}
+
+// ContractRegistry holds the contracts of the callbacks of spiders, by spider name.
+type ContractRegistry struct {
+	contracts map[string][]*CallbackContract
+	mutex     sync.RWMutex
+}
+
+func NewContractRegistry() *ContractRegistry {
+	return &ContractRegistry{
+		contracts: make(map[string][]*CallbackContract),
+	}
+}
+
+// DefaultContractRegistry holds the contracts registered with RegisterContract.
+var DefaultContractRegistry = NewContractRegistry()
+
+// RegisterContract registers the contract of a callback with DefaultContractRegistry,
+// usually from an init function next to Register. It panics if the annotations are invalid.
+func RegisterContract(spider, callback, annotations string) {
+	if err := DefaultContractRegistry.Register(spider, callback, annotations); err != nil {
+		panic(err)
+	}
+}
+
+// Register parses and registers the contract of the callback, i.e., the name of a method of the spider.
+// A callback can have several contracts, e.g., on different URLs.
+func (r *ContractRegistry) Register(spider, callback, annotations string) error {
+	cc, err := ParseContract(spider, callback, annotations)
+	if err != nil {
+		return fmt.Errorf("contract of %s.%s: %w", spider, callback, err)
+	}
+	r.mutex.Lock()
+	r.contracts[spider] = append(r.contracts[spider], cc)
+	r.mutex.Unlock()
+	return nil
+}
+
+// Contracts returns the contracts of the spider, in registration order.
+func (r *ContractRegistry) Contracts(spider string) []*CallbackContract {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return append([]*CallbackContract(nil), r.contracts[spider]...)
+}
+
+// Spiders returns the sorted names of the spiders with contracts.
+func (r *ContractRegistry) Spiders() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	names := make([]string, 0, len(r.contracts))
+	for name := range r.contracts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ContractResult is the outcome of checking a contract.
+type ContractResult struct {
+	Contract *CallbackContract
+	Errors   []error // the violations, or why the callback couldn't run
+}
+
+func (r *ContractResult) OK() bool {
+	return len(r.Errors) == 0
+}
+
+// ContractChecker runs the callbacks of spiders and checks their contracts.
+type ContractChecker struct {
+	Registry *ContractRegistry
+
+	// Fetch fetches the URL of a contract, online.
+	Fetch func(rawurl string) (*Response, error)
+
+	// Offline parses the fixtures of the contracts instead of fetching their URLs,
+	// relative to FixtureDir. Contracts without a fixture fail.
+	Offline    bool
+	FixtureDir string
+}
+
+// Check checks the contracts of the spider.
+func (cc *ContractChecker) Check(spider ISpider) []*ContractResult {
+	registry := cc.Registry
+	if registry == nil {
+		registry = DefaultContractRegistry
+	}
+
+	var results []*ContractResult
+	for _, contract := range registry.Contracts(spider.String()) {
+		result := &ContractResult{Contract: contract}
+		if err := cc.check(spider, contract, result); err != nil {
+			result.Errors = []error{err}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func (cc *ContractChecker) check(spider ISpider, contract *CallbackContract, result *ContractResult) error {
+	callback, err := SpiderCallback(spider, contract.Callback)
+	if err != nil {
+		return err
+	}
+
+	var response *Response
+	switch {
+	case cc.Offline && contract.Fixture == "":
+		return errors.New("no @fixture to check offline")
+	case cc.Offline:
+		response, err = NewFileResponse(contract.URL, filepath.Join(cc.FixtureDir, contract.Fixture))
+	case cc.Fetch == nil:
+		return errors.New("no fetcher to check online")
+	default:
+		response, err = cc.Fetch(contract.URL)
+	}
+	if err != nil {
+		return err
+	}
+
+	spiderResult, err := callback(response)
+	if err != nil {
+		return err
+	}
+	result.Errors = contract.Check(spiderResult)
+	return nil
+}
+
+// SpiderCallback returns the method of the spider with the name, if it is a callback.
+func SpiderCallback(spider ISpider, name string) (func(*Response) (*SpiderResult, error), error) {
+	method := reflect.ValueOf(spider).MethodByName(name)
+	if !method.IsValid() {
+		return nil, fmt.Errorf("spider %s has no method %s", spider, name)
+	}
+	callback, ok := method.Interface().(func(*Response) (*SpiderResult, error))
+	if !ok {
+		return nil, fmt.Errorf("method %s of spider %s is not a func(*Response) (*SpiderResult, error)", name, spider)
+	}
+	return callback, nil
+}
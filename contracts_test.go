@@ -0,0 +1,49 @@
+package spy
+
+import (
+	"strings"
+	"testing"
+)
+
+type contractProduct struct {
+	Title string  `spy:"title"`
+	Price float64 `spy:"price"`
+}
+
+func TestCallbackContractScrapesStructItem(t *testing.T) {
+	cc, err := ParseContract("shop", "ParseProduct", `
+		@url http://example.com/products/1
+		@returns items 1 1
+		@scrapes title`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := cc.Check(&SpiderResult{Items: []interface{}{&contractProduct{Price: 9.5}}})
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "misses title") {
+		t.Errorf("errors = %v, want the empty title missing", errs)
+	}
+
+	errs = cc.Check(&SpiderResult{Items: []interface{}{&contractProduct{Title: "Pen", Price: 9.5}}})
+	if len(errs) != 0 {
+		t.Errorf("errors = %v, want none", errs)
+	}
+}
+
+func TestCallbackContractReturns(t *testing.T) {
+	cc, err := ParseContract("shop", "Parse", `
+		@url http://example.com/
+		@returns requests 2
+		@returns items 0 0`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := cc.Check(&SpiderResult{
+		Requests: []*Request{NewRequest("http://example.com/1", "")},
+		Items:    []interface{}{&Item{"title": "Pen"}},
+	})
+	if len(errs) != 2 {
+		t.Errorf("errors = %v, want 2 violations", errs)
+	}
+}
@@ -0,0 +1,234 @@
+package spy
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// CoreStats is a crawler extension which records the core stats of a crawl from the events:
+//
+//	start_time, finish_time, elapsed (seconds)
+//	request_count, request_method_count/<method>, request_dropped_count
+//	response_received_count, response_status_count/<status>, response_bytes
+//	item_scraped_count, item_dropped_count, spider_error_count
+//	log_count/<level>, of the log entries with the spider field of the crawler
+//
+// When the spider closes, all the stats are dumped to the log.
+// If LogInterval is set, the crawl and scrape rates are also logged periodically.
+type CoreStats struct {
+	// LogInterval is the period of logging the rates of pages crawled and items scraped.
+	// Zero disables it.
+	LogInterval time.Duration
+
+	crawler *Crawler
+	subs    []*Subscription
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func NewCoreStats(crawler *Crawler) *CoreStats {
+	return &CoreStats{
+		crawler: crawler,
+	}
+}
+
+func (cs *CoreStats) Open(spider ISpider) {
+	events := cs.crawler.Events
+	cs.subscribe(events.OnSpiderOpened(cs.spiderOpened))
+	cs.subscribe(events.OnSpiderClosed(cs.spiderClosed))
+	cs.subscribe(events.OnRequestScheduled(cs.requestScheduled))
+	cs.subscribe(events.OnRequestDropped(cs.requestDropped))
+	cs.subscribe(events.OnResponseReceived(cs.responseReceived))
+	cs.subscribe(events.OnItemScraped(cs.itemScraped))
+	cs.subscribe(events.OnItemDropped(cs.itemDropped))
+	cs.subscribe(events.OnSpiderError(cs.spiderError))
+
+	countLogs(cs.crawler.Logger, spider, cs.crawler.Stats)
+
+	if cs.LogInterval > 0 {
+		cs.stop = make(chan struct{})
+		cs.wg.Add(1)
+		go cs.logStats()
+	}
+}
+
+func (cs *CoreStats) Close(spider ISpider) {
+	cs.crawler.Events.UnsubAll(cs.subs...)
+	cs.subs = nil
+
+	uncountLogs(cs.crawler.Logger, spider)
+
+	if cs.stop != nil {
+		close(cs.stop)
+		cs.wg.Wait()
+		cs.stop = nil
+	}
+}
+
+func (cs *CoreStats) subscribe(sub *Subscription, err error) {
+	if err != nil {
+		cs.crawler.Logger.WithError(err).WithField("spider", cs.crawler.Spider.String()).Error("Subscribing core stats")
+		return
+	}
+	cs.subs = append(cs.subs, sub)
+}
+
+func (cs *CoreStats) spiderOpened(spider ISpider) error {
+	cs.crawler.Stats.Set("start_time", time.Now())
+	return nil
+}
+
+func (cs *CoreStats) spiderClosed(spider ISpider, reason string) error {
+	stats := cs.crawler.Stats
+	now := time.Now()
+	stats.Set("finish_time", now)
+	if start := stats.GetTime("start_time"); !start.IsZero() {
+		stats.Set("elapsed", now.Sub(start))
+	}
+	cs.dumpStats()
+	return nil
+}
+
+func (cs *CoreStats) requestScheduled(spider ISpider, request *Request) error {
+	cs.crawler.Stats.Inc("request_count")
+	cs.crawler.Stats.Inc("request_method_count/" + request.Method)
+	return nil
+}
+
+func (cs *CoreStats) requestDropped(spider ISpider, request *Request) error {
+	cs.crawler.Stats.Inc("request_dropped_count")
+	return nil
+}
+
+func (cs *CoreStats) responseReceived(spider ISpider, request *Request, response *Response) error {
+	stats := cs.crawler.Stats
+	stats.Inc("response_received_count")
+	stats.Inc("response_status_count/" + strconv.Itoa(response.StatusCode))
+	// the buffered body, since ContentLength is -1 for chunked responses
+	stats.Inc("response_bytes", int64(len(response.RawBody())))
+	return nil
+}
+
+func (cs *CoreStats) itemScraped(spider ISpider, response *Response, item interface{}) error {
+	cs.crawler.Stats.Inc("item_scraped_count")
+	return nil
+}
+
+func (cs *CoreStats) itemDropped(spider ISpider, response *Response, item interface{}, err error) error {
+	cs.crawler.Stats.Inc("item_dropped_count")
+	return nil
+}
+
+func (cs *CoreStats) spiderError(spider ISpider, response *Response, err error) error {
+	cs.crawler.Stats.Inc("spider_error_count")
+	return nil
+}
+
+// logStats logs the rates of pages crawled and items scraped, per minute, every LogInterval.
+func (cs *CoreStats) logStats() {
+	defer cs.wg.Done()
+
+	stats := cs.crawler.Stats
+	var lastPages, lastItems int64
+	ticker := time.NewTicker(cs.LogInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-cs.stop:
+			return
+		case <-ticker.C:
+			pages := stats.GetInt("response_received_count")
+			items := stats.GetInt("item_scraped_count")
+			perMinute := float64(time.Minute) / float64(cs.LogInterval)
+			cs.crawler.Logger.WithField("spider", cs.crawler.Spider.String()).Infof(
+				"Crawled %d pages (at %.0f pages/min), scraped %d items (at %.0f items/min)",
+				pages, float64(pages-lastPages)*perMinute, items, float64(items-lastItems)*perMinute)
+			lastPages, lastItems = pages, items
+		}
+	}
+}
+
+func (cs *CoreStats) dumpStats() {
+	all := cs.crawler.Stats.GetAll()
+	keys := make([]string, 0, len(all))
+	for k := range all {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "\n  %s: %v", k, all[k])
+	}
+	cs.crawler.Logger.WithField("spider", cs.crawler.Spider.String()).Infof("Dumping spider stats:%s", buf.String())
+}
+
+// logCountHook counts the log entries per level, into the stats of the spider of their spider field,
+// which is either the spider or its name. Since logrus can't remove hooks, there is one hook per logger,
+// e.g., the standard logger shared by the crawlers of a runner, counting for the spiders open.
+type logCountHook struct {
+	mutex sync.RWMutex
+	stats map[ISpider]StatsCollector
+}
+
+var (
+	logCountHooks      = make(map[*logrus.Logger]*logCountHook)
+	logCountHooksMutex sync.Mutex
+)
+
+// countLogs counts the log entries of the spider into the stats, until uncountLogs.
+func countLogs(logger *logrus.Logger, spider ISpider, stats StatsCollector) {
+	logCountHooksMutex.Lock()
+	hook, ok := logCountHooks[logger]
+	if !ok {
+		hook = &logCountHook{stats: make(map[ISpider]StatsCollector)}
+		logCountHooks[logger] = hook
+		logger.AddHook(hook)
+	}
+	logCountHooksMutex.Unlock()
+
+	hook.mutex.Lock()
+	hook.stats[spider] = stats
+	hook.mutex.Unlock()
+}
+
+func uncountLogs(logger *logrus.Logger, spider ISpider) {
+	logCountHooksMutex.Lock()
+	hook := logCountHooks[logger]
+	logCountHooksMutex.Unlock()
+
+	if hook != nil {
+		hook.mutex.Lock()
+		delete(hook.stats, spider)
+		hook.mutex.Unlock()
+	}
+}
+
+func (h *logCountHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *logCountHook) Fire(entry *logrus.Entry) error {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	switch value := entry.Data["spider"].(type) {
+	case ISpider:
+		if stats, ok := h.stats[value]; ok {
+			stats.Inc("log_count/" + entry.Level.String())
+		}
+	case string:
+		for spider, stats := range h.stats {
+			if spider.String() == value {
+				stats.Inc("log_count/" + entry.Level.String())
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package spy
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestCoreStatsCountsLogsPerCrawler(t *testing.T) {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	var spiders []*testSpider
+	for _, name := range []string{"first", "second"} {
+		spider := newTestSpider(name)
+		spider.crawler.Logger = logger
+		cs := NewCoreStats(spider.crawler)
+		cs.Open(spider)
+		defer cs.Close(spider)
+		spiders = append(spiders, spider)
+	}
+	if hooks := len(logger.Hooks[logrus.ErrorLevel]); hooks != 1 {
+		t.Errorf("%d hooks on the logger, want 1", hooks)
+	}
+
+	logger.WithField("spider", "first").Error("by name")
+	logger.WithField("spider", spiders[0]).Error("by spider")
+	logger.WithField("spider", "second").Warn("other spider")
+	logger.Error("no spider")
+
+	for i, want := range []int64{2, 0} {
+		if n := spiders[i].crawler.Stats.GetInt("log_count/error"); n != want {
+			t.Errorf("log_count/error of %s = %d, want %d", spiders[i], n, want)
+		}
+	}
+	if n := spiders[1].crawler.Stats.GetInt("log_count/warning"); n != 1 {
+		t.Errorf("log_count/warning of second = %d, want 1", n)
+	}
+}
+
+func TestCoreStatsCountsEnqueuedRequests(t *testing.T) {
+	spider := newTestSpider("requests")
+	crawler := spider.crawler
+	crawler.Logger = logrus.New()
+	crawler.Scheduler = &Scheduler{dupeFilter: NewFingerprintDupeFilter(nil)}
+	crawler.Scheduler.Open(spider)
+	cs := NewCoreStats(crawler)
+	cs.Open(spider)
+	defer cs.Close(spider)
+
+	crawler.Crawl(NewRequest("http://shop.test/", "GET"), NewRequest("http://shop.test/", "GET"))
+	crawler.Events.WaitAsync()
+
+	if n := crawler.Stats.GetInt("request_count"); n != 1 {
+		t.Errorf("request_count = %d, want 1", n)
+	}
+	if n := crawler.Stats.GetInt("request_dropped_count"); n != 1 {
+		t.Errorf("request_dropped_count = %d, want 1", n)
+	}
+}
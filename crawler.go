@@ -1,93 +1,425 @@
 package spy
 
 import (
-	"github.com/Jeffail/tunny"
-	"github.com/Sirupsen/logrus"
-	"github.com/ridewindx/crumb/concurrency"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ridewindx/spy/internal/concurrency"
+	"github.com/sirupsen/logrus"
+	"os"
+	"os/signal"
 	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
 type Crawler struct {
 	*Config
 	*logrus.Logger
-	*Stats
+	Stats StatsCollector
+
+	// Events dispatches the events of this crawler only.
+	Events *EventBus
 
 	Concurrency int
 
+	// HandleSignals makes the crawler shut down gracefully on SIGINT or SIGTERM,
+	// and stop immediately on a second signal.
+	HandleSignals bool
+
+	// ShutdownTimeout bounds the wait for the responses being scraped and the items in the pipelines
+	// when the spider closes. Zero waits indefinitely.
+	ShutdownTimeout time.Duration
+
 	Spider    ISpider
 	Scheduler IScheduler
 	Fetcher   IFetcher
 	*SpiderMiddlewareManager
 	*ItemPipelineManager
 
-	crawling bool
+	extensions    []interface{}
+	requestBudget chan struct{} // shared by the crawlers of a CrawlerRunner
+
+	crawling     bool
+	scraping     int64  // responses being scraped in the work pool
+	finishReason string // set when the crawler starts stopping
+	ctx          context.Context
+	cancel       context.CancelFunc
+	ctxErr       error // of the context given to Run, if canceled
+	done         chan struct{}
+	forced       chan struct{}
+	mutex        sync.Mutex // guards the state above, except scraping
 
-	*tunny.WorkPool
+	*concurrency.WorkPool
 	*concurrency.Worker
 }
 
 func NewCrawler(spider ISpider, scheduler IScheduler) *Crawler {
 	concurrencyLimit := 100
 
-	return &Crawler{
-		Spider:      spider,
-		Scheduler:   scheduler,
-		Concurrency: concurrencyLimit,
-		WorkPool:    tunny.CreatePoolGeneric(concurrencyLimit),
-		Worker:      concurrency.NewWorker(),
+	c := &Crawler{
+		Spider:          spider,
+		Scheduler:       scheduler,
+		Events:          NewEventBus(),
+		Concurrency:     concurrencyLimit,
+		HandleSignals:   true,
+		ShutdownTimeout: time.Minute,
+		WorkPool:        concurrency.NewWorkPool(concurrencyLimit),
+		Worker:          concurrency.NewWorker(),
+	}
+	c.Events.ErrorHandler = c.logEventError
+	if cs, ok := spider.(CrawlerSetter); ok {
+		cs.SetCrawler(c)
+	}
+	return c
+}
+
+// NewDefaultCrawler returns a crawler of the spider with the default components:
+// a FIFO scheduler, an HTTP fetcher, in-memory stats, the standard logger,
+// and the CoreStats and CloseSpider extensions.
+func NewDefaultCrawler(spider ISpider, config *Config) *Crawler {
+	c := NewCrawler(spider, NewScheduler())
+	c.Config = config
+	c.Logger = logrus.StandardLogger()
+	c.Stats = NewStats(spider.String())
+	c.Fetcher = NewFetcher()
+	c.SpiderMiddlewareManager = &SpiderMiddlewareManager{}
+	c.ItemPipelineManager = &ItemPipelineManager{}
+	c.AddExtension(NewCoreStats(c))
+	c.AddExtension(NewCloseSpider(c))
+	return c
+}
+
+func (c *Crawler) logEventError(event Event, err error) {
+	c.Logger.WithError(err).WithField("spider", c.Spider.String()).Errorf("Handling event %s", event)
+}
+
+// AddExtension adds an extension, which is opened before the spider opens
+// and closed after the spider closes, if it is an Opener or a Closer.
+func (c *Crawler) AddExtension(extension interface{}) {
+	c.extensions = append(c.extensions, extension)
+}
+
+// Run starts the crawler and blocks until it stops, e.g., when the spider is idle.
+// Canceling the context stops the crawler immediately, canceling the requests being fetched
+// and the items in the pipelines, see Crawler.Context.
+// It returns a *CrawlError if the crawl was aborted, i.e., shut down or canceled.
+func (c *Crawler) Run(ctx context.Context) error {
+	if err := c.start(ctx); err != nil {
+		return err
 	}
+
+	done := c.done
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.mutex.Lock()
+			c.ctxErr = ctx.Err()
+			c.mutex.Unlock()
+			c.forceStop(FinishReasonCanceled)
+		case <-done:
+		}
+	}()
+
+	<-done
+	return c.Err()
 }
 
-func (c *Crawler) Start() {
-	// TODO: signal handling for SIGTERM, SIGINT, SIGBREAK
+// Start starts the crawler without waiting, see Run.
+func (c *Crawler) Start() error {
+	return c.start(context.Background())
+}
 
+func (c *Crawler) start(ctx context.Context) error {
+	c.mutex.Lock()
 	if c.crawling {
-		panic("Crawling already taking place")
+		c.mutex.Unlock()
+		return ErrCrawling
 	}
 	c.crawling = true
+	c.finishReason = ""
+	c.ctxErr = nil
+	c.done = make(chan struct{})
+	c.forced = make(chan struct{})
+	c.ctx, c.cancel = context.WithCancel(ctx)
+	c.mutex.Unlock()
+
+	if c.HandleSignals {
+		c.handleSignals()
+	}
 
 	c.WorkPool.Open()
 
-	c.openSpider()
+	if err := c.openSpider(); err != nil {
+		c.WorkPool.Close()
+		c.mutex.Lock()
+		c.crawling = false
+		c.cancel()
+		close(c.done)
+		c.mutex.Unlock()
+		return err
+	}
+
+	c.Events.pubCrawler(CrawlerStarted, c)
+	return nil
+}
+
+// Finish reasons of the spider, recorded as finish_reason in the stats.
+const (
+	FinishReasonFinished = "finished"
+	FinishReasonShutdown = "shutdown"
+	FinishReasonCanceled = "canceled"
+)
+
+// CrawlError reports an aborted crawl.
+type CrawlError struct {
+	Spider string
+	Reason string // the finish reason
+	Err    error  // the error of the context, if canceled
+}
+
+func (e *CrawlError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("crawl of %s aborted: %s: %s", e.Spider, e.Reason, e.Err)
+	}
+	return fmt.Sprintf("crawl of %s aborted: %s", e.Spider, e.Reason)
+}
+
+func (e *CrawlError) Unwrap() error {
+	return e.Err
+}
+
+// Err returns a *CrawlError once the crawler stopped, if the crawl was shut down or canceled, or nil.
+func (c *Crawler) Err() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.crawling {
+		return nil
+	}
+	switch c.finishReason {
+	case FinishReasonShutdown:
+		return &CrawlError{Spider: c.Spider.String(), Reason: c.finishReason}
+	case FinishReasonCanceled:
+		return &CrawlError{Spider: c.Spider.String(), Reason: c.finishReason, Err: c.ctxErr}
+	}
+	return nil
+}
 
-	CrawlerStarted.Pub(c)
+// Context returns the context of the crawl, which is done when the crawler is forced to stop.
+// Requests are fetched with it, so fetcher handlers and request callbacks can use Request.Context.
+func (c *Crawler) Context() context.Context {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// spiderContext returns the context of the crawler of the spider, if any.
+func spiderContext(spider ISpider) context.Context {
+	if spider != nil {
+		if c := spider.Crawler(); c != nil {
+			return c.Context()
+		}
+	}
+	return context.Background()
 }
 
+// Stop closes the spider with FinishReasonShutdown, unless it is already closing, and stops the crawler.
 func (c *Crawler) Stop() {
+	c.stop(FinishReasonShutdown)
+}
+
+// CloseSpider closes the spider for the reason and stops the crawler, without waiting.
+// Only the first reason is kept if it is called several times, e.g., by several extensions.
+func (c *Crawler) CloseSpider(reason string) {
+	go c.stop(reason)
+}
+
+// ForceStop stops the crawler without waiting for the work in flight.
+func (c *Crawler) ForceStop() {
+	c.forceStop(FinishReasonShutdown)
+}
+
+func (c *Crawler) forceStop(reason string) {
+	c.mutex.Lock()
+	if c.forced == nil {
+		c.mutex.Unlock()
+		return
+	}
+	select {
+	case <-c.forced:
+	default:
+		close(c.forced)
+		c.cancel()
+	}
+	c.mutex.Unlock()
+
+	c.CloseSpider(reason)
+}
+
+// Wait waits for the crawler to stop.
+func (c *Crawler) Wait() {
+	c.mutex.Lock()
+	done := c.done
+	c.mutex.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+func (c *Crawler) stop(reason string) {
+	c.mutex.Lock()
+	if !c.crawling || c.finishReason != "" {
+		c.mutex.Unlock()
+		return
+	}
+	c.finishReason = reason
+	c.mutex.Unlock()
+
+	c.closeSpider(reason)
+	// the scrapes left abort, see scrape, but aren't waited for if forced to stop
+	c.await(nil, c.WorkPool.Close)
+
+	c.mutex.Lock()
 	c.crawling = false
-	c.closeSpider()
-	c.WorkPool.Close()
-	c.Worker.Stop()
-	CrawlerStopped.Pub(c)
+	c.mutex.Unlock()
+
+	c.Events.pubCrawler(CrawlerStopped, c)
+	if !c.await(nil, c.Events.WaitAsync) {
+		c.Logger.WithField("spider", c.Spider.String()).Warn("Abandoned the asynchronous event handlers")
+	}
+	c.cancel()
+	close(c.done)
 }
 
-func (c *Crawler) openSpider() {
+var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+func (c *Crawler) handleSignals() {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, shutdownSignals...)
+	done := c.done
+
+	go func() {
+		defer signal.Stop(signals)
+
+		select {
+		case sig := <-signals:
+			c.Logger.WithField("spider", c.Spider.String()).Infof("Received %s, shutting down gracefully. Send again to force", sig)
+			c.CloseSpider(FinishReasonShutdown)
+		case <-done:
+			return
+		}
+
+		select {
+		case sig := <-signals:
+			c.Logger.WithField("spider", c.Spider.String()).Warnf("Received %s twice, forcing stop", sig)
+			c.ForceStop()
+		case <-done:
+		}
+	}()
+}
+
+// await runs fn and waits for it to return, unless the deadline passes or the crawler is forced to stop.
+func (c *Crawler) await(deadline <-chan time.Time, fn func()) bool {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn()
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-deadline:
+		return false
+	case <-c.forced:
+		return false
+	}
+}
+
+// closing returns whether the spider is closing, e.g., to stop scheduling requests.
+func (c *Crawler) closing() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.finishReason != ""
+}
+
+func (c *Crawler) openSpider() error {
 	c.Logger.WithField("spider", c.Spider.String()).Info("Opening spider")
 
 	startRequests, err := c.SpiderMiddlewareManager.ProcessStartRequests(c.Spider.StartRequests(), c.Spider)
 	if err != nil {
-		c.Logger.WithError(err).WithField("spider", c.Spider.String()).Panicf("Processing starting requests")
+		c.Logger.WithError(err).WithField("spider", c.Spider.String()).Error("Processing starting requests")
+		return err
 	}
 
 	c.Stats.Open(c.Spider)
+	openAll(c.Spider, c.extensions...)
 	c.Scheduler.Open(c.Spider)
 	c.ItemPipelineManager.Open(c.Spider)
 
-	SpiderOpened.Pub(c.Spider)
+	c.Events.pubSpider(SpiderOpened, c.Spider)
 
 	c.scheduleRequests(startRequests)
 
 	c.Logger.WithField("spider", c.Spider.String()).Info("Opened spider")
+	return nil
 }
 
-func (c *Crawler) closeSpider() {
-	c.Logger.WithField("spider", c.Spider.String()).Info("Closing spider")
+func (c *Crawler) closeSpider(reason string) {
+	c.Logger.WithFields(logrus.Fields{
+		"spider": c.Spider.String(),
+		"reason": reason,
+	}).Info("Closing spider")
+
+	var deadline <-chan time.Time
+	if c.ShutdownTimeout > 0 {
+		timer := time.NewTimer(c.ShutdownTimeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	// stop scheduling, and let the request being fetched, if any, be enqueued for scraping
+	if !c.await(deadline, c.Worker.Stop) {
+		c.Logger.WithField("spider", c.Spider.String()).Warn("Abandoned the request being fetched")
+	}
+
+	// let the responses being scraped reach the pipelines before closing them
+	drained := c.await(deadline, func() {
+		for c.Scraping() > 0 {
+			time.Sleep(backoutDelay)
+		}
+	})
+	if !drained {
+		c.Logger.WithField("spider", c.Spider.String()).Warnf("Abandoned %d responses being scraped", c.Scraping())
+	}
 
-	c.ItemPipelineManager.Close(c.Spider)
-	c.Scheduler.Close(c.Spider)
+	c.Stats.Set("finish_reason", reason)
+	if !c.await(deadline, func() { c.ItemPipelineManager.Close(c.Spider) }) {
+		c.Logger.WithField("spider", c.Spider.String()).Warnf("Abandoned %d items in the pipelines", c.ItemPipelineManager.InFlight())
+	}
+	// persists the state of the scheduler, e.g., seen requests
+	if !c.await(nil, func() { c.Scheduler.Close(c.Spider) }) {
+		c.Logger.WithField("spider", c.Spider.String()).Warn("Abandoned closing the scheduler")
+	}
 	c.Stats.Close(c.Spider)
 
-	SpiderClosed.Pub(c.Spider)
+	// wait for the handlers, e.g., flushing feeds, before closing the extensions,
+	// unless forced to stop; the bus bounds the wait with its Timeout
+	var errs []error
+	if c.await(nil, func() { errs = c.Events.pubSpiderClosedWait(c.Spider, reason) }) {
+		for _, err := range errs {
+			c.logEventError(SpiderClosed, err)
+		}
+	} else {
+		c.Logger.WithField("spider", c.Spider.String()).Warnf("Abandoned the %s handlers", SpiderClosed)
+	}
+
+	closeAll(c.Spider, c.extensions...)
 
 	c.Logger.WithField("spider", c.Spider.String()).Info("Closed spider")
 }
@@ -100,11 +432,32 @@ func (c *Crawler) Resume() {
 	c.Worker.Resume()
 }
 
+// Crawl schedules requests, e.g., from SpiderIdle handlers.
+func (c *Crawler) Crawl(requests ...*Request) {
+	for _, request := range requests {
+		c.enqueueRequest(request)
+	}
+}
+
+// enqueueRequest publishes RequestScheduled once the scheduler accepted the request,
+// or RequestDropped, e.g., for a duplicate, or a request which failed to be created, see NewRequest.
+// The context of the crawl is attached beforehand, since the request can be fetched while the handlers run.
 func (c *Crawler) enqueueRequest(request *Request) {
-	RequestScheduled.Pub(c.Spider, request)
-	ok := c.Scheduler.EnqueueRequest(request)
-	if !ok {
-		RequestDropped.Pub(c.Spider, request)
+	if request == nil {
+		return
+	}
+	if request.Request == nil {
+		c.Logger.WithError(request.Error).WithField("spider", c.Spider.String()).Error("Dropping invalid request")
+		c.Events.pubRequest(RequestDropped, c.Spider, request)
+		return
+	}
+	if request.Context() == context.Background() {
+		request.Request = request.Request.WithContext(c.Context())
+	}
+	if c.Scheduler.EnqueueRequest(request) {
+		c.Events.pubRequest(RequestScheduled, c.Spider, request)
+	} else {
+		c.Events.pubRequest(RequestDropped, c.Spider, request)
 	}
 }
 
@@ -115,24 +468,79 @@ func (c *Crawler) scheduleRequests(startRequests []*Request) {
 			c.enqueueRequest(request)
 		}
 
-		for sentry.Stopped() && !c.needsBackout() {
+		for !sentry.Stopped() && !c.closing() {
 			sentry.Sleep()
 
+			if c.needsBackout() {
+				time.Sleep(backoutDelay) // let fetcher and pipelines drain
+				continue
+			}
+
 			request := c.Scheduler.NextRequest()
 			if request == nil {
-				break
+				if !c.idle() {
+					time.Sleep(backoutDelay) // work in flight may schedule new requests
+					continue
+				}
+				if c.spiderIdle() {
+					c.CloseSpider(FinishReasonFinished)
+					return
+				}
+				if c.Scheduler.Pending() == 0 {
+					time.Sleep(backoutDelay) // kept open, poll again later
+				}
+				continue
 			}
 			c.fetch(request)
 		}
 	})
 }
 
+// idle returns whether there is no work left: no pending requests, no requests being fetched,
+// no responses being scraped and no items in the pipelines.
+func (c *Crawler) idle() bool {
+	if c.Scheduler.Pending() > 0 || c.Scraping() > 0 || c.ItemPipelineManager.InFlight() > 0 {
+		return false
+	}
+	if fm, ok := c.Fetcher.(fetcherMetrics); ok && fm.Active() > 0 {
+		return false
+	}
+	return true
+}
+
+const backoutDelay = 100 * time.Millisecond
+
 func (c *Crawler) needsBackout() bool {
-	return !c.crawling // TODO
+	return c.Fetcher.NeedsBackout() || c.ItemPipelineManager.NeedsBackout()
+}
+
+// spiderIdle publishes SpiderIdle, waiting for the handlers,
+// and returns whether the spider can be closed, i.e., no handler scheduled requests
+// or returned ErrDontCloseSpider.
+func (c *Crawler) spiderIdle() bool {
+	canClose := true
+	for _, err := range c.Events.pubSpiderWait(SpiderIdle, c.Spider) {
+		if errors.Is(err, ErrDontCloseSpider) {
+			canClose = false
+		} else {
+			c.logEventError(SpiderIdle, err)
+		}
+	}
+	return canClose && c.Scheduler.Pending() == 0
 }
 
 func (c *Crawler) fetch(request *Request) {
+	if c.requestBudget != nil {
+		select {
+		case c.requestBudget <- struct{}{}:
+		case <-c.Context().Done():
+			return // forced to stop
+		}
+	}
 	rep, req, err := c.Fetcher.Fetch(request, c.Spider)
+	if c.requestBudget != nil {
+		<-c.requestBudget
+	}
 
 	if err != nil {
 		c.enqueueScrape(nil, err, request) // enqueue fetching error
@@ -141,11 +549,12 @@ func (c *Crawler) fetch(request *Request) {
 	if rep != nil {
 		rep.Request = request // tie request to response received
 		c.Logger.WithFields(logrus.Fields{
+			"spider":  c.Spider.String(),
 			"event":   "RequestCrawled",
 			"status":  rep.StatusCode,
 			"request": request,
 		}).Debugf("Crawled request %s, status %d", request, rep.StatusCode)
-		ResponseReceived.Pub(c.Spider, request, rep)
+		c.Events.pubResponse(ResponseReceived, c.Spider, request, rep)
 
 		c.enqueueScrape(rep, nil, request) // enqueue fetching response
 	} else { // fetcher can return request, i.e., redirect
@@ -154,12 +563,27 @@ func (c *Crawler) fetch(request *Request) {
 }
 
 func (c *Crawler) enqueueScrape(response *Response, err error, request *Request) {
+	atomic.AddInt64(&c.scraping, 1)
 	c.WorkPool.SendWorkAsync(func() {
+		defer atomic.AddInt64(&c.scraping, -1)
 		c.scrape(response, err, request)
-	}, nil)
+	}, func(poolErr error) {
+		if poolErr != nil { // not scraped, e.g., the pool is closed
+			atomic.AddInt64(&c.scraping, -1)
+		}
+	})
+}
+
+// Scraping returns the number of responses being scraped, or waiting for the work pool.
+func (c *Crawler) Scraping() int {
+	return int(atomic.LoadInt64(&c.scraping))
 }
 
 func (c *Crawler) scrape(response *Response, err error, request *Request) {
+	if c.Context().Err() != nil {
+		return // forced to stop
+	}
+
 	var result *SpiderResult
 	if err == nil {
 		// spider and spider middlewares scrape the response
@@ -167,11 +591,14 @@ func (c *Crawler) scrape(response *Response, err error, request *Request) {
 	} else if request.Callback != nil {
 		result, err = request.Callback(nil, err) // request callback handles fetching error
 		if err != nil && err != ErrIgnoreRequest {
-			c.Logger.WithError(err).Errorf("Fetching request %s", request)
+			c.Logger.WithError(err).WithField("spider", c.Spider.String()).Errorf("Fetching request %s", request)
 		}
 	}
 
 	if err == nil {
+		if result == nil { // nothing scraped
+			return
+		}
 		for _, req := range result.Requests {
 			c.processSpiderRequest(req)
 		}
@@ -183,36 +610,45 @@ func (c *Crawler) scrape(response *Response, err error, request *Request) {
 		if err == ErrSpiderClosed {
 			return
 		}
-		c.Logger.WithError(err).Errorf("Processing request %s (referer: %s)", request, request.Header.Get("Referer"))
-		SpiderError.Pub(c.Spider, response, err)
+		c.Logger.WithError(err).WithField("spider", c.Spider.String()).Errorf("Processing request %s (referer: %s)", request, request.Header.Get("Referer"))
+		c.Events.pubSpiderError(c.Spider, response, err)
 		c.Stats.Inc("SpiderError/" + reflect.TypeOf(err).Name())
 	}
 }
 
+// processSpiderRequest schedules a request yielded by a callback, through the dupefilter of the scheduler.
+// It is counted as pending before the response which yielded it is done scraping, so the spider is not idle.
 func (c *Crawler) processSpiderRequest(request *Request) {
-	c.WorkPool.SendWorkAsync(func() {
-
-	}, nil)
+	c.enqueueRequest(request)
 }
 
-func (c *Crawler) processSpiderItem(item *Item, response *Response) {
-	c.WorkPool.SendWorkAsync(func() {
-		resultItem, err := c.ItemPipelineManager.ProcessItem(item, c.Spider)
+func (c *Crawler) processSpiderItem(item interface{}, response *Response) {
+	if _, err := NewItemAdapter(item); err != nil {
+		c.Logger.WithError(err).WithField("spider", c.Spider.String()).Errorf("Invalid item %v from %s", item, response)
+		c.Events.pubSpiderError(c.Spider, response, err)
+		return
+	}
 
-		if err == ErrItemDropped {
+	// pipelines run outside the work pool, so that slow ones don't starve scraping
+	c.ItemPipelineManager.ProcessItemAsync(item, c.Spider, func(resultItem interface{}, err error) {
+		if errors.Is(err, ErrItemDropped) {
 			c.Logger.WithFields(logrus.Fields{
-				"event": "ItemDropped",
-				"item":  item,
+				"spider": c.Spider.String(),
+				"event":  "ItemDropped",
+				"item":   item,
+				"reason": err,
 			}).Warnf("Dropped item %s", item)
-			ItemDropped.Pub(c.Spider, response, item)
+			c.Events.pubItemDropped(c.Spider, response, item, err)
 		} else if err != nil {
-			c.Logger.WithError(err).Errorf("Processing item %s", item)
+			c.Logger.WithError(err).WithField("spider", c.Spider.String()).Errorf("Processing item %s", item)
 		} else {
 			c.Logger.WithFields(logrus.Fields{
-				"event": "ItemScraped",
-				"item":  resultItem,
-				"src":   response,
+				"spider": c.Spider.String(),
+				"event":  "ItemScraped",
+				"item":   resultItem,
+				"src":    response,
 			}).Debugf("Scraped item %s from %s", resultItem, response)
+			c.Events.pubItemScraped(c.Spider, response, resultItem)
 		}
-	}, nil)
+	})
 }
@@ -4,8 +4,8 @@ import (
 	"os"
 	"bufio"
 	"strings"
-	"github.com/ridewindx/crumb/set"
-	"github.com/Sirupsen/logrus"
+	"github.com/ridewindx/spy/internal/set"
+	"github.com/sirupsen/logrus"
 )
 
 type DupeFilter interface {
@@ -1,9 +1,51 @@
 package spy
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
 
 var (
 	ErrSpiderClosed  = errors.New("spider closed")
 	ErrItemDropped   = errors.New("item dropped")
 	ErrIgnoreRequest = errors.New("request ignored")
+	ErrCrawling      = errors.New("crawling already taking place")
+
+	// ErrDontCloseSpider is returned by SpiderIdle handlers to keep the spider open,
+	// e.g., to poll for new requests.
+	ErrDontCloseSpider = errors.New("don't close spider")
 )
+
+// FieldError describes why a field of an item is invalid.
+type FieldError struct {
+	Field   string
+	Rule    string // the violated constraint, e.g., "required", "pattern"
+	Message string
+}
+
+func (e FieldError) String() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// ItemDroppedError drops an item for a structured reason.
+// It matches ErrItemDropped with errors.Is.
+type ItemDroppedError struct {
+	Reason string
+	Fields []FieldError
+}
+
+func (e *ItemDroppedError) Error() string {
+	if len(e.Fields) == 0 {
+		return "item dropped: " + e.Reason
+	}
+	fields := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		fields[i] = f.String()
+	}
+	return fmt.Sprintf("item dropped: %s (%s)", e.Reason, strings.Join(fields, "; "))
+}
+
+func (e *ItemDroppedError) Is(target error) bool {
+	return target == ErrItemDropped
+}
@@ -1,17 +1,18 @@
 package spy
 
 import (
-	"github.com/asaskevich/EventBus"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
 )
 
-var bus = EventBus.New()
-
 type Event string
 
 const (
 	CrawlerStarted     Event = "CrawlerStarted"
 	CrawlerStopped     Event = "CrawlerStopped"
-	SpiderOpened       Event = "SpiderOpened "
+	SpiderOpened       Event = "SpiderOpened"
 	SpiderIdle         Event = "SpiderIdle"
 	SpiderClosed       Event = "SpiderClosed"
 	SpiderError        Event = "SpiderError"
@@ -23,18 +24,316 @@ const (
 	ItemDropped        Event = "ItemDropped"
 )
 
-func (e Event) SubAsync(fn interface{}) {
-	panic(bus.SubscribeAsync(string(e), fn, false))
+// Handler signatures, one per kind of event.
+// The errors returned by handlers are passed to the ErrorHandler of the bus,
+// except for the events the crawler waits for, i.e., SpiderIdle and SpiderClosed,
+// whose handlers can return ErrDontCloseSpider on SpiderIdle to keep the spider open.
+type (
+	CrawlerHandler      func(crawler *Crawler) error
+	SpiderHandler       func(spider ISpider) error
+	SpiderClosedHandler func(spider ISpider, reason string) error
+	SpiderErrorHandler  func(spider ISpider, response *Response, err error) error
+	RequestHandler      func(spider ISpider, request *Request) error
+	ResponseHandler     func(spider ISpider, request *Request, response *Response) error
+	ItemScrapedHandler  func(spider ISpider, response *Response, item interface{}) error
+	ItemDroppedHandler  func(spider ISpider, response *Response, item interface{}, err error) error
+)
+
+var (
+	ErrNotSubscribed  = errors.New("not subscribed")
+	ErrHandlerTimeout = errors.New("event handler timed out")
+	ErrEventKind      = errors.New("wrong kind of event")
+)
+
+// Subscription identifies a handler subscribed to an event, to unsubscribe it.
+type Subscription struct {
+	event   Event
+	handler interface{}
+	async   bool
+}
+
+func (s *Subscription) Event() Event {
+	return s.event
+}
+
+// EventBus dispatches the events of a crawler to the subscribed handlers.
+// Every crawler has its own bus, so that crawlers in the same process don't receive each other's events.
+type EventBus struct {
+	// Timeout bounds the wait for the handlers of the events published with waiting,
+	// i.e., SpiderIdle and SpiderClosed by the crawler, and the Publish...Wait methods.
+	// Handlers still running after it keep running, but are no longer waited for.
+	Timeout time.Duration
+
+	// ErrorHandler, if not nil, receives the errors returned by handlers of events not waited for.
+	ErrorHandler func(event Event, err error)
+
+	subscriptions map[Event][]*Subscription
+	mutex         sync.RWMutex
+	waitGroup     sync.WaitGroup // async handlers
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{
+		Timeout:       time.Minute,
+		subscriptions: make(map[Event][]*Subscription),
+	}
+}
+
+func (b *EventBus) OnCrawlerStarted(handler CrawlerHandler, async ...bool) (*Subscription, error) {
+	return b.sub(CrawlerStarted, handler, handler == nil, async)
+}
+
+func (b *EventBus) OnCrawlerStopped(handler CrawlerHandler, async ...bool) (*Subscription, error) {
+	return b.sub(CrawlerStopped, handler, handler == nil, async)
+}
+
+func (b *EventBus) OnSpiderOpened(handler SpiderHandler, async ...bool) (*Subscription, error) {
+	return b.sub(SpiderOpened, handler, handler == nil, async)
+}
+
+func (b *EventBus) OnSpiderIdle(handler SpiderHandler, async ...bool) (*Subscription, error) {
+	return b.sub(SpiderIdle, handler, handler == nil, async)
+}
+
+func (b *EventBus) OnSpiderClosed(handler SpiderClosedHandler, async ...bool) (*Subscription, error) {
+	return b.sub(SpiderClosed, handler, handler == nil, async)
+}
+
+func (b *EventBus) OnSpiderError(handler SpiderErrorHandler, async ...bool) (*Subscription, error) {
+	return b.sub(SpiderError, handler, handler == nil, async)
+}
+
+func (b *EventBus) OnRequestScheduled(handler RequestHandler, async ...bool) (*Subscription, error) {
+	return b.sub(RequestScheduled, handler, handler == nil, async)
+}
+
+func (b *EventBus) OnRequestDropped(handler RequestHandler, async ...bool) (*Subscription, error) {
+	return b.sub(RequestDropped, handler, handler == nil, async)
+}
+
+func (b *EventBus) OnResponseReceived(handler ResponseHandler, async ...bool) (*Subscription, error) {
+	return b.sub(ResponseReceived, handler, handler == nil, async)
+}
+
+func (b *EventBus) OnResponseDownloaded(handler ResponseHandler, async ...bool) (*Subscription, error) {
+	return b.sub(ResponseDownloaded, handler, handler == nil, async)
+}
+
+func (b *EventBus) OnItemScraped(handler ItemScrapedHandler, async ...bool) (*Subscription, error) {
+	return b.sub(ItemScraped, handler, handler == nil, async)
+}
+
+func (b *EventBus) OnItemDropped(handler ItemDroppedHandler, async ...bool) (*Subscription, error) {
+	return b.sub(ItemDropped, handler, handler == nil, async)
+}
+
+func (b *EventBus) sub(event Event, handler interface{}, isNil bool, async []bool) (*Subscription, error) {
+	if isNil {
+		return nil, errors.New("nil handler for event " + string(event))
+	}
+	s := &Subscription{
+		event:   event,
+		handler: handler,
+		async:   len(async) > 0 && async[0],
+	}
+
+	b.mutex.Lock()
+	b.subscriptions[event] = append(b.subscriptions[event], s)
+	b.mutex.Unlock()
+	return s, nil
+}
+
+// Unsub unsubscribes the handler of the subscription, or returns ErrNotSubscribed.
+func (b *EventBus) Unsub(s *Subscription) error {
+	if s == nil {
+		return ErrNotSubscribed
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	subs := b.subscriptions[s.event]
+	for i, sub := range subs {
+		if sub == s {
+			b.subscriptions[s.event] = append(subs[:i:i], subs[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotSubscribed
+}
+
+// UnsubAll unsubscribes the handlers of the subscriptions, ignoring the ones not subscribed.
+func (b *EventBus) UnsubAll(subs ...*Subscription) {
+	for _, s := range subs {
+		b.Unsub(s)
+	}
+}
+
+// WaitAsync waits for the running asynchronous handlers.
+func (b *EventBus) WaitAsync() {
+	b.waitGroup.Wait()
+}
+
+// publish calls the handlers subscribed to the event, in subscription order,
+// without waiting for the asynchronous ones.
+func (b *EventBus) publish(event Event, call func(handler interface{}) error) {
+	for _, s := range b.subscribed(event) {
+		if s.async {
+			b.waitGroup.Add(1)
+			go func(handler interface{}) {
+				defer b.waitGroup.Done()
+				b.handleError(event, call(handler))
+			}(s.handler)
+		} else {
+			b.handleError(event, call(s.handler))
+		}
+	}
+}
+
+// publishWait calls the handlers subscribed to the event concurrently, synchronous or not,
+// and waits for them up to Timeout. It returns the errors of the handlers,
+// and ErrHandlerTimeout for each handler which didn't return in time.
+func (b *EventBus) publishWait(event Event, call func(handler interface{}) error) []error {
+	subs := b.subscribed(event)
+	if len(subs) == 0 {
+		return nil
+	}
+
+	results := make(chan error, len(subs)) // buffered, so that late handlers don't leak
+	for _, s := range subs {
+		go func(handler interface{}) {
+			results <- call(handler)
+		}(s.handler)
+	}
+
+	var timeout <-chan time.Time
+	if b.Timeout > 0 {
+		timer := time.NewTimer(b.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var errs []error
+	for pending := len(subs); pending > 0; pending-- {
+		select {
+		case err := <-results:
+			if err != nil {
+				errs = append(errs, err)
+			}
+		case <-timeout:
+			for ; pending > 0; pending-- {
+				errs = append(errs, fmt.Errorf("%s: %w", event, ErrHandlerTimeout))
+			}
+			return errs
+		}
+	}
+	return errs
+}
+
+func (b *EventBus) subscribed(event Event) []*Subscription {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return b.subscriptions[event]
+}
+
+func (b *EventBus) handleError(event Event, err error) {
+	if err != nil && b.ErrorHandler != nil {
+		b.ErrorHandler(event, err)
+	}
+}
+
+func (b *EventBus) pubCrawler(event Event, crawler *Crawler) {
+	b.publish(event, func(h interface{}) error { return h.(CrawlerHandler)(crawler) })
+}
+
+func (b *EventBus) pubSpider(event Event, spider ISpider) {
+	b.publish(event, func(h interface{}) error { return h.(SpiderHandler)(spider) })
+}
+
+// The Publish...Wait methods publish an event and wait for its handlers, e.g., so that an extension
+// can finish its work before the caller proceeds. The handlers run concurrently, asynchronous or not,
+// and are waited for up to Timeout. The returned error joins the errors of the handlers,
+// and ErrHandlerTimeout for each handler which didn't return in time; it is nil if all of them succeeded.
+// The errors are not passed to ErrorHandler.
+// The methods taking an event return ErrEventKind, without publishing, for the events of other handler signatures.
+
+func (b *EventBus) PublishCrawlerWait(event Event, crawler *Crawler) error {
+	if err := checkEvent(event, CrawlerStarted, CrawlerStopped); err != nil {
+		return err
+	}
+	return errors.Join(b.publishWait(event, func(h interface{}) error { return h.(CrawlerHandler)(crawler) })...)
+}
+
+func (b *EventBus) PublishSpiderWait(event Event, spider ISpider) error {
+	if err := checkEvent(event, SpiderOpened, SpiderIdle); err != nil {
+		return err
+	}
+	return errors.Join(b.pubSpiderWait(event, spider)...)
+}
+
+func (b *EventBus) PublishSpiderClosedWait(spider ISpider, reason string) error {
+	return errors.Join(b.pubSpiderClosedWait(spider, reason)...)
+}
+
+func (b *EventBus) PublishSpiderErrorWait(spider ISpider, response *Response, err error) error {
+	return errors.Join(b.publishWait(SpiderError, func(h interface{}) error { return h.(SpiderErrorHandler)(spider, response, err) })...)
+}
+
+func (b *EventBus) PublishRequestWait(event Event, spider ISpider, request *Request) error {
+	if err := checkEvent(event, RequestScheduled, RequestDropped); err != nil {
+		return err
+	}
+	return errors.Join(b.publishWait(event, func(h interface{}) error { return h.(RequestHandler)(spider, request) })...)
+}
+
+func (b *EventBus) PublishResponseWait(event Event, spider ISpider, request *Request, response *Response) error {
+	if err := checkEvent(event, ResponseReceived, ResponseDownloaded); err != nil {
+		return err
+	}
+	return errors.Join(b.publishWait(event, func(h interface{}) error { return h.(ResponseHandler)(spider, request, response) })...)
+}
+
+func (b *EventBus) PublishItemScrapedWait(spider ISpider, response *Response, item interface{}) error {
+	return errors.Join(b.publishWait(ItemScraped, func(h interface{}) error { return h.(ItemScrapedHandler)(spider, response, item) })...)
+}
+
+func (b *EventBus) PublishItemDroppedWait(spider ISpider, response *Response, item interface{}, err error) error {
+	return errors.Join(b.publishWait(ItemDropped, func(h interface{}) error { return h.(ItemDroppedHandler)(spider, response, item, err) })...)
+}
+
+// checkEvent returns ErrEventKind unless the event is one of the events.
+func checkEvent(event Event, events ...Event) error {
+	for _, e := range events {
+		if event == e {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrEventKind, event)
+}
+
+func (b *EventBus) pubSpiderWait(event Event, spider ISpider) []error {
+	return b.publishWait(event, func(h interface{}) error { return h.(SpiderHandler)(spider) })
+}
+
+func (b *EventBus) pubSpiderClosedWait(spider ISpider, reason string) []error {
+	return b.publishWait(SpiderClosed, func(h interface{}) error { return h.(SpiderClosedHandler)(spider, reason) })
+}
+
+func (b *EventBus) pubSpiderError(spider ISpider, response *Response, err error) {
+	b.publish(SpiderError, func(h interface{}) error { return h.(SpiderErrorHandler)(spider, response, err) })
+}
+
+func (b *EventBus) pubRequest(event Event, spider ISpider, request *Request) {
+	b.publish(event, func(h interface{}) error { return h.(RequestHandler)(spider, request) })
 }
 
-func (e Event) Sub(fn interface{}) {
-	panic(bus.Subscribe(string(e), fn))
+func (b *EventBus) pubResponse(event Event, spider ISpider, request *Request, response *Response) {
+	b.publish(event, func(h interface{}) error { return h.(ResponseHandler)(spider, request, response) })
 }
 
-func (e Event) Unsub(fn interface{}) {
-	panic(bus.Unsubscribe(string(e), fn))
+func (b *EventBus) pubItemScraped(spider ISpider, response *Response, item interface{}) {
+	b.publish(ItemScraped, func(h interface{}) error { return h.(ItemScrapedHandler)(spider, response, item) })
 }
 
-func (e Event) Pub(args ...interface{}) {
-	bus.Publish(string(e), args...)
+func (b *EventBus) pubItemDropped(spider ISpider, response *Response, item interface{}, err error) {
+	b.publish(ItemDropped, func(h interface{}) error { return h.(ItemDroppedHandler)(spider, response, item, err) })
 }
@@ -0,0 +1,78 @@
+package spy
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPublishWaitCollectsErrors(t *testing.T) {
+	bus := NewEventBus()
+	errFirst := errors.New("first")
+	errSecond := errors.New("second")
+	calls := 0
+	bus.OnSpiderIdle(func(spider ISpider) error { return errFirst })
+	bus.OnSpiderIdle(func(spider ISpider) error { return nil })
+	bus.OnSpiderIdle(func(spider ISpider) error { return errSecond }, true)
+	bus.ErrorHandler = func(event Event, err error) { calls++ }
+
+	err := bus.PublishSpiderWait(SpiderIdle, newTestSpider("events"))
+	if !errors.Is(err, errFirst) || !errors.Is(err, errSecond) {
+		t.Errorf("err = %v, want both handler errors", err)
+	}
+	if calls != 0 {
+		t.Errorf("ErrorHandler called %d times, want 0", calls)
+	}
+
+	if err = bus.PublishSpiderClosedWait(newTestSpider("events"), FinishReasonFinished); err != nil {
+		t.Errorf("err = %v without handlers, want nil", err)
+	}
+}
+
+func TestPublishWaitTimeout(t *testing.T) {
+	bus := NewEventBus()
+	bus.Timeout = 50 * time.Millisecond
+	release := make(chan struct{})
+	defer close(release)
+
+	var reason string
+	bus.OnSpiderClosed(func(spider ISpider, r string) error {
+		reason = r
+		return nil
+	})
+	bus.OnSpiderClosed(func(spider ISpider, r string) error {
+		<-release
+		return nil
+	})
+
+	start := time.Now()
+	err := bus.PublishSpiderClosedWait(newTestSpider("events"), FinishReasonShutdown)
+	if !errors.Is(err, ErrHandlerTimeout) {
+		t.Errorf("err = %v, want ErrHandlerTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("waited %s, want about %s", elapsed, bus.Timeout)
+	}
+	if reason != FinishReasonShutdown {
+		t.Errorf("reason = %q, want %q", reason, FinishReasonShutdown)
+	}
+}
+
+func TestPublishWaitEventKind(t *testing.T) {
+	bus := NewEventBus()
+	called := false
+	bus.OnSpiderClosed(func(spider ISpider, reason string) error {
+		called = true
+		return nil
+	})
+
+	if err := bus.PublishSpiderWait(SpiderClosed, newTestSpider("events")); !errors.Is(err, ErrEventKind) {
+		t.Errorf("err = %v, want ErrEventKind", err)
+	}
+	if err := bus.PublishRequestWait(ItemScraped, newTestSpider("events"), nil); !errors.Is(err, ErrEventKind) {
+		t.Errorf("err = %v, want ErrEventKind", err)
+	}
+	if called {
+		t.Error("SpiderClosed handler called by PublishSpiderWait")
+	}
+}
@@ -2,9 +2,10 @@ package spy
 
 import (
 	"fmt"
-	"github.com/ridewindx/crumb/dnscache"
+	"github.com/ridewindx/spy/internal/dnscache"
 	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -26,13 +27,15 @@ type Fetcher struct {
 	middleManager *FetcherMiddlewareManager
 	slots         map[string]*fetchSlot
 	dnscache      *dnscache.Resolver
-	active        int
+	active        int64
 	rand          *rand.Rand
 	mutex         *sync.RWMutex
 	closed        chan struct{}
 	waitGroup     *sync.WaitGroup
 }
 
+// FetcherHandler fetches the requests of a URL scheme.
+// Fetch should give up when the context of the request is done, see Crawler.Context.
 type FetcherHandler interface {
 	Fetch(request *Request, spider ISpider) (*Response, error)
 	Close()
@@ -56,46 +59,82 @@ type fetchSlot struct {
 	closed      chan struct{}
 }
 
+// NewFetcher returns a fetcher of HTTP and HTTPS requests.
 func NewFetcher() *Fetcher {
-	return &Fetcher{
-		handlers:      make(map[string]FetcherHandler),
-		middleManager: &FetcherMiddlewareManager{},
-		slots:         make(map[string]*fetchSlot),
-		dnscache:      dnscache.New(8192, time.Minute),
-		rand:          rand.New(rand.NewSource(time.Now().UTC().UnixNano())),
-		mutex:         &sync.RWMutex{},
-		closed:        make(chan struct{}),
-		waitGroup:     &sync.WaitGroup{},
+	f := &Fetcher{
+		TotalConcurrency:  16,
+		DomainConcurrency: 8,
+		handlers:          make(map[string]FetcherHandler),
+		middleManager:     &FetcherMiddlewareManager{},
+		slots:             make(map[string]*fetchSlot),
+		dnscache:          dnscache.New(8192, time.Minute),
+		rand:              rand.New(rand.NewSource(time.Now().UTC().UnixNano())),
+		mutex:             &sync.RWMutex{},
+		closed:            make(chan struct{}),
+		waitGroup:         &sync.WaitGroup{},
 	}
+	httpHandler := NewHTTPFetcherHandler()
+	f.RegisterHandler("http", httpHandler)
+	f.RegisterHandler("https", httpHandler)
+	return f
 }
 
-func (f *Fetcher) Open(spider ISpider) {
+// RegisterHandler sets the handler fetching the requests of the URL scheme.
+func (f *Fetcher) RegisterHandler(scheme string, handler FetcherHandler) {
+	f.handlers[scheme] = handler
+}
+
+// RegisterMiddleware appends the middleware to the fetcher middleware chain.
+func (f *Fetcher) RegisterMiddleware(middleware FetcherMiddleware) {
+	f.middleManager.Register(middleware)
+}
 
+func (f *Fetcher) Open(spider ISpider) {
+	f.waitGroup.Add(1)
 	go f.gcSlots()
 }
 
+// Close closes the handlers and stops the slots, waiting for the requests being fetched.
 func (f *Fetcher) Close(spider ISpider) {
 	for _, handler := range f.handlers {
 		handler.Close()
 	}
 
 	close(f.closed)
-	for _, slot := range f.slots {
+	f.mutex.Lock()
+	for key, slot := range f.slots {
+		delete(f.slots, key)
 		close(slot.closed)
 	}
+	f.mutex.Unlock()
 
 	f.waitGroup.Wait()
 }
 
+// NeedsBackout reports whether TotalConcurrency requests are being fetched. Zero means no limit.
 func (f *Fetcher) NeedsBackout() bool {
-	return f.active >= f.TotalConcurrency
+	return f.TotalConcurrency > 0 && f.Active() >= f.TotalConcurrency
+}
+
+// Active returns the number of requests being fetched.
+func (f *Fetcher) Active() int {
+	return int(atomic.LoadInt64(&f.active))
+}
+
+// SlotOccupancy returns the number of requests being fetched by each slot, i.e., domain or IP.
+func (f *Fetcher) SlotOccupancy() map[string]int {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	occupancy := make(map[string]int, len(f.slots))
+	for key, slot := range f.slots {
+		occupancy[key] = len(slot.holders)
+	}
+	return occupancy
 }
 
 func (f *Fetcher) Fetch(req *Request, spider ISpider) (*Response, *Request, error) {
-	f.active++
-	defer func() {
-		f.active--
-	}()
+	atomic.AddInt64(&f.active, 1)
+	defer atomic.AddInt64(&f.active, -1)
 
 	return f.middleManager.process(f.fetchRequest, req, spider)
 }
@@ -109,17 +148,39 @@ func (f *Fetcher) fetchRequest(req *Request, spider ISpider) (*Response, error)
 		slot = f.addSlot(key, spider)
 	}
 
-	result := make(chan *fetchResult)
+	ctx := req.Context()
+	result := make(chan *fetchResult, 1) // buffered, so that the fetch completes even if abandoned
 
-	slot.holders <- struct{}{}
-	slot.tasks <- &fetchTask{req, result}
+	select {
+	case slot.holders <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	select {
+	case slot.tasks <- &fetchTask{req, result}:
+	case <-ctx.Done():
+		<-slot.holders
+		return nil, ctx.Err()
+	}
 
+	select {
+	case r := <-result:
+		return r.response, r.err
+	case <-ctx.Done():
+		go discardFetchResult(result)
+		return nil, ctx.Err()
+	}
+}
+
+// discardFetchResult closes the body of the response of an abandoned fetch, to release its connection.
+func discardFetchResult(result <-chan *fetchResult) {
 	r := <-result
-	return r.response, r.err
+	if r.response != nil && r.response.Response != nil && r.response.Response.Body != nil {
+		r.response.Response.Body.Close()
+	}
 }
 
 func (f *Fetcher) runSlot(slot *fetchSlot, spider ISpider) {
-	f.waitGroup.Add(1)
 	defer f.waitGroup.Done()
 
 	for {
@@ -133,13 +194,22 @@ func (f *Fetcher) runSlot(slot *fetchSlot, spider ISpider) {
 			if delay > 0 {
 				penalty := delay - now.Sub(slot.lastSeen)
 				if penalty > 0 {
-					time.Sleep(penalty)
+					select {
+					case <-time.After(penalty):
+					case <-slot.closed:
+						return
+					}
 					continue
 				}
 			}
 
 			for {
-				task := <-slot.tasks
+				var task *fetchTask
+				select {
+				case task = <-slot.tasks:
+				case <-slot.closed:
+					return
+				}
 
 				slot.lastSeen = time.Now()
 				f.waitGroup.Add(1)
@@ -178,8 +248,8 @@ func (f *Fetcher) computedDelay(spider ISpider) time.Duration {
 		delay = f.Delay
 	}
 
-	if f.RandomizeDelay {
-		return time.Duration(0.5*delay + f.rand.Int63n(int64(delay)))
+	if f.RandomizeDelay && delay > 0 {
+		return delay/2 + time.Duration(f.rand.Int63n(int64(delay))) // between 0.5 and 1.5 times the delay
 	} else {
 		return delay
 	}
@@ -191,7 +261,7 @@ func (f *Fetcher) getSlotKey(req *Request) string {
 		key = k.(string)
 	} else {
 		key = req.URL.Host // TODO: strip port
-		if f.IpConcurrency {
+		if f.IpConcurrency > 0 {
 			k, err := f.dnscache.FetchOneString(key)
 			if err == nil {
 				key = k
@@ -217,6 +287,7 @@ func (f *Fetcher) addSlot(key string, spider ISpider) *fetchSlot {
 	slot.holders = make(chan struct{}, slot.concurrency)
 	slot.tasks = make(chan *fetchTask)
 
+	f.waitGroup.Add(1)
 	go f.runSlot(slot, spider)
 
 	f.mutex.Lock()
@@ -227,7 +298,6 @@ func (f *Fetcher) addSlot(key string, spider ISpider) *fetchSlot {
 }
 
 func (f *Fetcher) gcSlots() {
-	f.waitGroup.Add(1)
 	defer f.waitGroup.Done()
 
 	ticker := time.NewTicker(time.Minute)
@@ -252,7 +322,7 @@ func (f *Fetcher) gcSlots() {
 				delete(f.slots, key)
 				close(slot.closed)
 			}
-			f.mutex.RUnlock()
+			f.mutex.Unlock()
 		}
 	}
 }
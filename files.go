@@ -0,0 +1,275 @@
+package spy
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileResult describes a file stored by the FilesPipeline.
+type FileResult struct {
+	URL      string    `json:"url"`
+	Path     string    `json:"path"`     // relative to the store directory
+	Checksum string    `json:"checksum"` // MD5 of the downloaded content
+	Status   string    `json:"status"`   // "downloaded", or "uptodate" if not expired
+	Time     time.Time `json:"time"`     // when the file was downloaded
+}
+
+// FilesPipeline downloads the files whose URLs are listed in an item field,
+// through the fetcher of the crawler, so that its throttling and middlewares apply.
+// Files are stored under the path full/<SHA1 of content><extension> of the store directory,
+// and their FileResults are set to another item field.
+type FilesPipeline struct {
+	// Store is the directory where files are stored.
+	Store string
+
+	// URLsField is the item field holding the URLs of the files, as a string or a slice.
+	// Defaults to "file_urls".
+	URLsField string
+
+	// ResultsField is the item field which is set to the []FileResult of the stored files.
+	// Defaults to "files".
+	ResultsField string
+
+	// Files downloaded less than Expires ago are not downloaded again.
+	// Defaults to 90 days.
+	Expires time.Duration
+
+	// MaxRedirects is the maximum number of redirections followed for a file. Defaults to 10.
+	MaxRedirects int
+
+	*logrus.Logger
+
+	// save stores the downloaded content, and returns its path.
+	save func(content []byte, response *Response) (string, error)
+
+	index     map[string]*FileResult // URL -> last stored file
+	indexFile *os.File
+	mutex     sync.Mutex
+	statsName string // prefix of stats keys
+}
+
+func NewFilesPipeline(logger *logrus.Logger, store string) *FilesPipeline {
+	fp := &FilesPipeline{
+		Store:        store,
+		URLsField:    "file_urls",
+		ResultsField: "files",
+		Expires:      90 * 24 * time.Hour,
+		MaxRedirects: 10,
+		Logger:       logger,
+		statsName:    "file",
+	}
+	fp.save = fp.saveFile
+	return fp
+}
+
+// Open loads the index of the stored files, which is kept in the store directory across runs.
+func (fp *FilesPipeline) Open(spider ISpider) {
+	fp.index = make(map[string]*FileResult)
+
+	err := os.MkdirAll(fp.Store, 0755)
+	if err != nil {
+		panic(err)
+	}
+	fp.indexFile, err = os.OpenFile(filepath.Join(fp.Store, "index.jsonl"), os.O_RDWR|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		panic(err)
+	}
+
+	scanner := bufio.NewScanner(fp.indexFile)
+	for scanner.Scan() {
+		var result FileResult
+		if json.Unmarshal(scanner.Bytes(), &result) == nil {
+			fp.index[result.URL] = &result // later lines win
+		}
+	}
+	err = scanner.Err()
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (fp *FilesPipeline) Close(spider ISpider) {
+	if fp.indexFile != nil {
+		fp.indexFile.Close()
+	}
+}
+
+func (fp *FilesPipeline) ProcessItem(item interface{}, spider ISpider) (interface{}, error) {
+	adapter, err := NewItemAdapter(item)
+	if err != nil {
+		return nil, err
+	}
+
+	value, _ := adapter.Get(fp.URLsField)
+	urls, err := toStrings(value)
+	if err != nil {
+		return nil, fmt.Errorf("field %s: %s", fp.URLsField, err)
+	}
+
+	results := make([]*FileResult, len(urls))
+	var wg sync.WaitGroup
+	for i, u := range urls {
+		wg.Add(1)
+		go func(i int, u string) {
+			defer wg.Done()
+			result, err := fp.fileResult(u, spider)
+			if err != nil {
+				if fp.Logger != nil {
+					fp.WithError(err).WithField("spider", spider).Warnf("Downloading %s %s", fp.statsName, u)
+				}
+				spider.Crawler().Stats.Inc(fp.statsName + "_status_count/failed")
+				return
+			}
+			spider.Crawler().Stats.Inc(fp.statsName + "_status_count/" + result.Status)
+			results[i] = result
+		}(i, u)
+	}
+	wg.Wait()
+
+	var stored []FileResult
+	for _, result := range results {
+		if result != nil {
+			stored = append(stored, *result)
+		}
+	}
+	if len(urls) > 0 {
+		spider.Crawler().Stats.Inc(fp.statsName + "_count") // items with files
+	}
+
+	if err = adapter.Set(fp.ResultsField, stored); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// fileResult returns the stored file of the URL, downloading it unless it has not expired.
+func (fp *FilesPipeline) fileResult(u string, spider ISpider) (*FileResult, error) {
+	fp.mutex.Lock()
+	last, ok := fp.index[u]
+	fp.mutex.Unlock()
+	if ok && time.Since(last.Time) < fp.Expires {
+		if _, err := os.Stat(filepath.Join(fp.Store, last.Path)); err == nil {
+			result := *last
+			result.Status = "uptodate"
+			return &result, nil
+		}
+	}
+
+	response, err := fp.download(u, spider)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Close()
+
+	content := response.RawBody() // as received, i.e., not decoded to UTF-8
+	p, err := fp.save(content, response)
+	if err != nil {
+		return nil, err
+	}
+
+	checksum := md5.Sum(content)
+	result := &FileResult{
+		URL:      u,
+		Path:     p,
+		Checksum: hex.EncodeToString(checksum[:]),
+		Status:   "downloaded",
+		Time:     time.Now(),
+	}
+
+	line, _ := json.Marshal(result)
+	fp.mutex.Lock()
+	fp.index[u] = result
+	fp.indexFile.Write(append(line, '\n'))
+	fp.mutex.Unlock()
+
+	return result, nil
+}
+
+// download fetches the URL through the fetcher of the crawler, following the returned requests.
+func (fp *FilesPipeline) download(u string, spider ISpider) (*Response, error) {
+	request := NewRequest(u, http.MethodGet)
+	for i := 0; i <= fp.MaxRedirects; i++ {
+		if request.Error != nil {
+			return nil, request.Error
+		}
+		request.Request = request.Request.WithContext(spiderContext(spider))
+
+		response, req, err := spider.Crawler().Fetcher.Fetch(request, spider)
+		if err != nil {
+			return nil, err
+		}
+		if response == nil {
+			request = req // redirected
+			continue
+		}
+
+		if response.StatusCode != http.StatusOK {
+			response.Close()
+			return nil, fmt.Errorf("status %d", response.StatusCode)
+		}
+		return response, nil
+	}
+	return nil, fmt.Errorf("more than %d redirections", fp.MaxRedirects)
+}
+
+func (fp *FilesPipeline) saveFile(content []byte, response *Response) (string, error) {
+	ext := path.Ext(response.Response.Request.URL.Path)
+	if ext == "" {
+		if exts, _ := mime.ExtensionsByType(response.MediaType); len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+	return fp.write(path.Join("full", contentHash(content)+ext), content)
+}
+
+// write writes the content to the path relative to the store directory, and returns the path.
+func (fp *FilesPipeline) write(p string, content []byte) (string, error) {
+	filename := filepath.Join(fp.Store, filepath.FromSlash(p))
+	err := os.MkdirAll(filepath.Dir(filename), 0755)
+	if err != nil {
+		return "", err
+	}
+	return p, ioutil.WriteFile(filename, content, 0644)
+}
+
+func contentHash(content []byte) string {
+	h := sha1.Sum(content)
+	return hex.EncodeToString(h[:])
+}
+
+// toStrings converts a string or a slice of strings held in an interface.
+func toStrings(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []string:
+		return v, nil
+	case []interface{}:
+		strs := make([]string, len(v))
+		for i, e := range v {
+			s, ok := e.(string)
+			if !ok {
+				return nil, fmt.Errorf("%v is not a string", e)
+			}
+			strs[i] = s
+		}
+		return strs, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %T, must be a string or a slice of strings", value)
+	}
+}
@@ -0,0 +1,31 @@
+package spy
+
+import (
+	"net/http"
+	"time"
+)
+
+// HTTPFetcherHandler fetches HTTP and HTTPS requests with an http.Client.
+type HTTPFetcherHandler struct {
+	Client *http.Client
+}
+
+func NewHTTPFetcherHandler() *HTTPFetcherHandler {
+	return &HTTPFetcherHandler{
+		Client: &http.Client{
+			Timeout: 3 * time.Minute,
+		},
+	}
+}
+
+func (h *HTTPFetcherHandler) Fetch(request *Request, spider ISpider) (*Response, error) {
+	hr, err := h.Client.Do(request.Request)
+	if err != nil {
+		return nil, err
+	}
+	return NewResponse(hr)
+}
+
+func (h *HTTPFetcherHandler) Close() {
+	h.Client.CloseIdleConnections()
+}
@@ -0,0 +1,144 @@
+package spy
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // register decoders
+	"image/jpeg"
+	"image/png"
+	"path"
+)
+
+// ImagesPipeline is a FilesPipeline for images, which are converted to a common format,
+// filtered by a minimum size, and from which thumbnails are generated.
+// Images are stored under full/<SHA1 of content>.<format>, and thumbnails
+// under thumbs/<thumb name>/<SHA1 of content>.<format>.
+type ImagesPipeline struct {
+	*FilesPipeline
+
+	// Images smaller than MinWidth or MinHeight are not stored.
+	MinWidth  int
+	MinHeight int
+
+	// Thumbs maps the name of a thumbnail to its maximum size.
+	// Thumbnails keep the aspect ratio of the image, and are never larger than the image.
+	Thumbs map[string]image.Point
+
+	// Format of the stored images, either "jpeg" or "png". Defaults to "jpeg".
+	Format string
+
+	// Quality of JPEG images, from 1 to 100. Defaults to jpeg.DefaultQuality.
+	Quality int
+}
+
+func NewImagesPipeline(logger *logrus.Logger, store string) *ImagesPipeline {
+	ip := &ImagesPipeline{
+		FilesPipeline: NewFilesPipeline(logger, store),
+		Format:        "jpeg",
+		Quality:       jpeg.DefaultQuality,
+	}
+	ip.URLsField = "image_urls"
+	ip.ResultsField = "images"
+	ip.statsName = "image"
+	ip.save = ip.saveImage
+	return ip
+}
+
+func (ip *ImagesPipeline) saveImage(content []byte, response *Response) (string, error) {
+	img, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return "", err
+	}
+
+	size := img.Bounds().Size()
+	if size.X < ip.MinWidth || size.Y < ip.MinHeight {
+		return "", fmt.Errorf("image too small (%dx%d < %dx%d)", size.X, size.Y, ip.MinWidth, ip.MinHeight)
+	}
+
+	name := contentHash(content) + "." + ip.Format
+	data, err := ip.encode(img)
+	if err != nil {
+		return "", err
+	}
+	p, err := ip.write(path.Join("full", name), data)
+	if err != nil {
+		return "", err
+	}
+
+	for thumbName, thumbSize := range ip.Thumbs {
+		data, err = ip.encode(thumbnail(img, thumbSize))
+		if err != nil {
+			return "", err
+		}
+		_, err = ip.write(path.Join("thumbs", thumbName, name), data)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return p, nil
+}
+
+func (ip *ImagesPipeline) encode(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch ip.Format {
+	case "jpeg":
+		// JPEG has no alpha channel, paste transparent images on a white background
+		b := img.Bounds()
+		rgba := image.NewRGBA(b)
+		draw.Draw(rgba, b, image.White, image.Point{}, draw.Src)
+		draw.Draw(rgba, b, img, b.Min, draw.Over)
+		err = jpeg.Encode(&buf, rgba, &jpeg.Options{Quality: ip.Quality})
+	case "png":
+		err = png.Encode(&buf, img)
+	default:
+		err = fmt.Errorf("unsupported image format '%s'", ip.Format)
+	}
+	return buf.Bytes(), err
+}
+
+// thumbnail scales the image down to fit within the size, keeping its aspect ratio.
+// Each pixel of the thumbnail averages the pixels of the image it covers.
+func thumbnail(src image.Image, size image.Point) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= size.X && h <= size.Y {
+		return src
+	}
+
+	if w*size.Y > h*size.X {
+		w, h = size.X, h*size.X/w
+	} else {
+		w, h = w*size.Y/h, size.Y
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+
+	dst := image.NewRGBA64(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		sy0, sy1 := b.Min.Y+y*b.Dy()/h, b.Min.Y+(y+1)*b.Dy()/h
+		for x := 0; x < w; x++ {
+			sx0, sx1 := b.Min.X+x*b.Dx()/w, b.Min.X+(x+1)*b.Dx()/w
+
+			var r, g, bl, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.SetRGBA64(x, y, color.RGBA64{uint16(r / n), uint16(g / n), uint16(bl / n), uint16(a / n)})
+		}
+	}
+	return dst
+}
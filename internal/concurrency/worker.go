@@ -0,0 +1,120 @@
+// Package concurrency provides the worker loop and the work pool of the crawler.
+package concurrency
+
+import "sync"
+
+// Worker runs a loop in a goroutine, which can be paused, resumed and stopped.
+// It can be started again once stopped.
+type Worker struct {
+	mutex  sync.Mutex
+	sentry *Sentry
+	done   chan struct{}
+}
+
+func NewWorker() *Worker {
+	return &Worker{}
+}
+
+// Start runs fn in a new goroutine. fn should return once the sentry is stopped.
+// It does nothing if the worker is running.
+func (w *Worker) Start(fn func(sentry *Sentry)) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.sentry != nil {
+		return
+	}
+
+	sentry := newSentry()
+	done := make(chan struct{})
+	w.sentry, w.done = sentry, done
+	go func() {
+		defer close(done)
+		fn(sentry)
+	}()
+}
+
+// Stop stops the sentry and waits for the loop to return.
+func (w *Worker) Stop() {
+	w.mutex.Lock()
+	sentry, done := w.sentry, w.done
+	w.sentry, w.done = nil, nil
+	w.mutex.Unlock()
+
+	if sentry != nil {
+		sentry.stop()
+		<-done
+	}
+}
+
+// Pause makes Sentry.Sleep block until the worker is resumed or stopped.
+func (w *Worker) Pause() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.sentry != nil {
+		w.sentry.pause()
+	}
+}
+
+func (w *Worker) Resume() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.sentry != nil {
+		w.sentry.resume()
+	}
+}
+
+// Sentry is polled by the loop of a worker.
+type Sentry struct {
+	mutex   sync.Mutex
+	resumed chan struct{} // nil unless paused
+	stopped chan struct{}
+}
+
+func newSentry() *Sentry {
+	return &Sentry{stopped: make(chan struct{})}
+}
+
+// Stopped returns whether the worker is stopped, i.e., the loop should return.
+func (s *Sentry) Stopped() bool {
+	select {
+	case <-s.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+// Sleep blocks while the worker is paused, unless it is stopped.
+func (s *Sentry) Sleep() {
+	s.mutex.Lock()
+	resumed := s.resumed
+	s.mutex.Unlock()
+
+	if resumed != nil {
+		select {
+		case <-resumed:
+		case <-s.stopped:
+		}
+	}
+}
+
+func (s *Sentry) pause() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.resumed == nil {
+		s.resumed = make(chan struct{})
+	}
+}
+
+func (s *Sentry) resume() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.resumed != nil {
+		close(s.resumed)
+		s.resumed = nil
+	}
+}
+
+func (s *Sentry) stop() {
+	close(s.stopped)
+}
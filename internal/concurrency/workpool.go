@@ -0,0 +1,99 @@
+package concurrency
+
+import (
+	"errors"
+	"sync"
+)
+
+var ErrPoolNotRunning = errors.New("the work pool is not running")
+
+// WorkPool runs jobs on a fixed number of goroutines.
+// It can be opened again once closed.
+type WorkPool struct {
+	size    int
+	mutex   sync.RWMutex
+	jobs    chan func() // nil unless open
+	closed  chan struct{}
+	workers *sync.WaitGroup // of the last opening, which an unfinished Close may still wait for
+}
+
+func NewWorkPool(size int) *WorkPool {
+	return &WorkPool{size: size}
+}
+
+// Open starts the goroutines of the pool.
+func (p *WorkPool) Open() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.jobs != nil {
+		return
+	}
+
+	p.jobs = make(chan func())
+	p.closed = make(chan struct{})
+	p.workers = &sync.WaitGroup{}
+	for i := 0; i < p.size; i++ {
+		p.workers.Add(1)
+		go p.work(p.jobs, p.closed, p.workers)
+	}
+}
+
+func (p *WorkPool) work(jobs <-chan func(), closed <-chan struct{}, workers *sync.WaitGroup) {
+	defer workers.Done()
+	for {
+		select {
+		case job := <-jobs:
+			job()
+		case <-closed:
+			return
+		}
+	}
+}
+
+// Close rejects the jobs waiting for a goroutine, and waits for the jobs being run.
+func (p *WorkPool) Close() {
+	p.mutex.Lock()
+	if p.jobs == nil {
+		p.mutex.Unlock()
+		return
+	}
+	close(p.closed)
+	p.jobs = nil
+	workers := p.workers
+	p.mutex.Unlock()
+
+	workers.Wait()
+}
+
+// SendWork runs the job on a goroutine of the pool and waits for it to return.
+// It returns ErrPoolNotRunning, without running the job, if the pool is or gets closed before a goroutine is free.
+func (p *WorkPool) SendWork(job func()) error {
+	p.mutex.RLock()
+	jobs, closed := p.jobs, p.closed
+	p.mutex.RUnlock()
+	if jobs == nil {
+		return ErrPoolNotRunning
+	}
+
+	done := make(chan struct{})
+	select {
+	case jobs <- func() {
+		defer close(done)
+		job()
+	}:
+	case <-closed:
+		return ErrPoolNotRunning
+	}
+	<-done
+	return nil
+}
+
+// SendWorkAsync is like SendWork, without waiting. after, if not nil, is called with the error of SendWork.
+func (p *WorkPool) SendWorkAsync(job func(), after func(err error)) {
+	go func() {
+		err := p.SendWork(job)
+		if after != nil {
+			after(err)
+		}
+	}()
+}
@@ -0,0 +1,74 @@
+// Package dnscache caches the addresses of hosts for a while.
+package dnscache
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+type entry struct {
+	addrs   []string
+	expires time.Time
+}
+
+type Resolver struct {
+	size    int
+	ttl     time.Duration
+	mutex   sync.Mutex
+	entries map[string]*entry
+}
+
+// New returns a resolver caching the addresses of up to size hosts for ttl.
+func New(size int, ttl time.Duration) *Resolver {
+	return &Resolver{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[string]*entry),
+	}
+}
+
+// Fetch returns the addresses of the host, looking them up unless cached.
+func (r *Resolver) Fetch(host string) ([]string, error) {
+	now := time.Now()
+
+	r.mutex.Lock()
+	e, ok := r.entries[host]
+	r.mutex.Unlock()
+	if ok && now.Before(e.expires) {
+		return e.addrs, nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupHost(context.Background(), host)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if len(r.entries) >= r.size {
+		for h, e := range r.entries {
+			if !now.Before(e.expires) {
+				delete(r.entries, h)
+			}
+		}
+		if len(r.entries) >= r.size {
+			for h := range r.entries { // evict any
+				delete(r.entries, h)
+				break
+			}
+		}
+	}
+	r.entries[host] = &entry{addrs: addrs, expires: now.Add(r.ttl)}
+	return addrs, nil
+}
+
+// FetchOneString returns the first address of the host.
+func (r *Resolver) FetchOneString(host string) (string, error) {
+	addrs, err := r.Fetch(host)
+	if err != nil {
+		return "", err
+	}
+	return addrs[0], nil
+}
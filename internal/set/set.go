@@ -0,0 +1,32 @@
+// Package set provides a set of strings safe for concurrent use.
+package set
+
+import "sync"
+
+type Set struct {
+	mutex  sync.RWMutex
+	values map[string]struct{}
+}
+
+func NewSet() *Set {
+	return &Set{values: make(map[string]struct{})}
+}
+
+func (s *Set) Add(value string) {
+	s.mutex.Lock()
+	s.values[value] = struct{}{}
+	s.mutex.Unlock()
+}
+
+func (s *Set) Contains(value string) bool {
+	s.mutex.RLock()
+	_, ok := s.values[value]
+	s.mutex.RUnlock()
+	return ok
+}
+
+func (s *Set) Len() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.values)
+}
@@ -0,0 +1,269 @@
+package spy
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ItemAdapter exposes the fields of an item uniformly, whatever its type.
+// Supported items are *Item, Item and pointers to structs whose fields are tagged with `spy:"field"`.
+type ItemAdapter interface {
+	// Item returns the adapted item.
+	Item() interface{}
+
+	// Fields returns the declared fields of a struct item, or the present fields of a map item.
+	Fields() []string
+
+	// Get returns the value of the field, and whether the field is set.
+	Get(field string) (value interface{}, ok bool)
+
+	// Set sets the value of the field.
+	// It fails if the field is not declared by a struct item, or if the value doesn't fit its type.
+	Set(field string, value interface{}) error
+}
+
+func NewItemAdapter(item interface{}) (ItemAdapter, error) {
+	switch it := item.(type) {
+	case *Item:
+		if it == nil {
+			return nil, fmt.Errorf("nil item")
+		}
+		if *it == nil {
+			*it = make(Item)
+		}
+		return mapItemAdapter{it}, nil
+	case Item:
+		if it == nil {
+			return nil, fmt.Errorf("nil item")
+		}
+		return mapItemAdapter{&it}, nil
+	}
+
+	v := reflect.ValueOf(item)
+	if v.Kind() != reflect.Ptr || v.Type().Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("unsupported item type %T, must be *Item or a pointer to struct", item)
+	}
+	if v.IsNil() {
+		return nil, fmt.Errorf("nil item of type %T", item)
+	}
+	fields, err := structItemFields(v.Elem().Type())
+	if err != nil {
+		return nil, err
+	}
+	return &structItemAdapter{v.Elem(), fields}, nil
+}
+
+// ItemFields returns the fields declared by a struct item type, in declaration order.
+// The item can be a struct, a pointer to struct, or a reflect.Type of them.
+func ItemFields(item interface{}) ([]string, error) {
+	t, ok := item.(reflect.Type)
+	if !ok {
+		t = reflect.TypeOf(item)
+	}
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("unsupported item type %v, must be a struct", t)
+	}
+	fields, err := structItemFields(t)
+	if err != nil {
+		return nil, err
+	}
+	return fields.names, nil
+}
+
+// itemAsMap returns the set fields of the item.
+func itemAsMap(adapter ItemAdapter) map[string]interface{} {
+	m := make(map[string]interface{})
+	for _, field := range adapter.Fields() {
+		if value, ok := adapter.Get(field); ok {
+			m[field] = value
+		}
+	}
+	return m
+}
+
+type mapItemAdapter struct {
+	item *Item
+}
+
+func (a mapItemAdapter) Item() interface{} {
+	return a.item
+}
+
+func (a mapItemAdapter) Fields() []string {
+	fields := make([]string, 0, len(*a.item))
+	for field := range *a.item {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func (a mapItemAdapter) Get(field string) (interface{}, bool) {
+	value, ok := (*a.item)[field]
+	return value, ok
+}
+
+func (a mapItemAdapter) Set(field string, value interface{}) error {
+	(*a.item)[field] = value
+	return nil
+}
+
+// fieldMissing returns whether the field of the item is missing, i.e., not set, nil or the zero value of its type,
+// e.g., "" or 0, since struct items always have their fields. Validation and contracts use this rule.
+func fieldMissing(item ItemAdapter, field string) bool {
+	value, ok := item.Get(field)
+	return !ok || value == nil || reflect.ValueOf(value).IsZero()
+}
+
+type itemFields struct {
+	names   []string
+	indexes map[string][]int
+}
+
+var itemFieldsCache sync.Map // reflect.Type -> *itemFields
+
+// structItemFields parses the spy tags of the struct type.
+// Tag options after a comma are ignored here, they are left to other consumers, e.g., validators.
+func structItemFields(t reflect.Type) (*itemFields, error) {
+	if fields, ok := itemFieldsCache.Load(t); ok {
+		return fields.(*itemFields), nil
+	}
+
+	fields := &itemFields{indexes: make(map[string][]int)}
+	for _, sf := range reflect.VisibleFields(t) {
+		tag, ok := sf.Tag.Lookup("spy")
+		if !ok {
+			continue
+		}
+		name := strings.TrimSpace(strings.Split(tag, ",")[0])
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			return nil, fmt.Errorf("item type %s: empty spy tag on field %s", t, sf.Name)
+		}
+		if !sf.IsExported() {
+			return nil, fmt.Errorf("item type %s: spy tag on unexported field %s", t, sf.Name)
+		}
+		if _, ok := fields.indexes[name]; ok {
+			return nil, fmt.Errorf("item type %s: duplicate field %s", t, name)
+		}
+		fields.names = append(fields.names, name)
+		fields.indexes[name] = sf.Index
+	}
+	if len(fields.names) == 0 {
+		return nil, fmt.Errorf("item type %s declares no field with spy tag", t)
+	}
+
+	itemFieldsCache.Store(t, fields)
+	return fields, nil
+}
+
+type structItemAdapter struct {
+	value  reflect.Value // the struct
+	fields *itemFields
+}
+
+func (a *structItemAdapter) Item() interface{} {
+	return a.value.Addr().Interface()
+}
+
+func (a *structItemAdapter) Fields() []string {
+	return a.fields.names
+}
+
+func (a *structItemAdapter) Get(field string) (interface{}, bool) {
+	index, ok := a.fields.indexes[field]
+	if !ok {
+		return nil, false
+	}
+	v, err := a.value.FieldByIndexErr(index)
+	if err != nil { // through a nil embedded pointer
+		return nil, false
+	}
+	if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+		return nil, false
+	}
+	return v.Interface(), true
+}
+
+func (a *structItemAdapter) Set(field string, value interface{}) error {
+	index, ok := a.fields.indexes[field]
+	if !ok {
+		return fmt.Errorf("unknown field %s of item type %s", field, a.value.Type())
+	}
+	if value == nil {
+		if v, err := a.value.FieldByIndexErr(index); err == nil {
+			v.Set(reflect.Zero(v.Type()))
+		} // else already unset, through a nil embedded pointer
+		return nil
+	}
+	v, err := fieldByIndexAlloc(a.value, index)
+	if err != nil {
+		return fmt.Errorf("setting field %s of item type %s: %s", field, a.value.Type(), err)
+	}
+	if err := assignValue(v, reflect.ValueOf(value)); err != nil {
+		return fmt.Errorf("setting field %s of item type %s: %s", field, a.value.Type(), err)
+	}
+	return nil
+}
+
+// fieldByIndexAlloc is like reflect.Value.FieldByIndex, allocating the nil embedded pointers on the way.
+func fieldByIndexAlloc(v reflect.Value, index []int) (reflect.Value, error) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, fmt.Errorf("nil pointer to unexported embedded struct %s", v.Type().Elem())
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, nil
+}
+
+// assignValue assigns src to dst, converting it if needed, element by element for slices.
+func assignValue(dst, src reflect.Value) error {
+	if src.Kind() == reflect.Interface && !src.IsNil() {
+		src = src.Elem()
+	}
+
+	switch {
+	case src.Type().AssignableTo(dst.Type()):
+		dst.Set(src)
+	case dst.Kind() == reflect.Ptr: // optional field
+		p := reflect.New(dst.Type().Elem())
+		if err := assignValue(p.Elem(), src); err != nil {
+			return err
+		}
+		dst.Set(p)
+	case src.Kind() == reflect.Slice && dst.Kind() == reflect.Slice:
+		s := reflect.MakeSlice(dst.Type(), src.Len(), src.Len())
+		for i := 0; i < src.Len(); i++ {
+			if err := assignValue(s.Index(i), src.Index(i)); err != nil {
+				return err
+			}
+		}
+		dst.Set(s)
+	case src.Kind() == reflect.Slice && src.Len() == 1: // single value collected for a scalar field
+		return assignValue(dst, src.Index(0))
+	case isNumberKind(src.Kind()) && isNumberKind(dst.Kind()) && src.Type().ConvertibleTo(dst.Type()):
+		dst.Set(src.Convert(dst.Type()))
+	default:
+		return fmt.Errorf("cannot assign value of type %s to %s", src.Type(), dst.Type())
+	}
+	return nil
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Float64
+}
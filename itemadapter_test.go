@@ -0,0 +1,37 @@
+package spy
+
+import "testing"
+
+type Offer struct {
+	Price float64 `spy:"price"`
+}
+
+type productItem struct {
+	Name string `spy:"name"`
+	*Offer
+}
+
+func TestStructItemAdapterSetNilEmbeddedPointer(t *testing.T) {
+	item := &productItem{}
+	adapter, err := NewItemAdapter(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := adapter.Get("price"); ok {
+		t.Error("price is set through a nil embedded pointer")
+	}
+	if err = adapter.Set("price", nil); err != nil || item.Offer != nil {
+		t.Errorf("unsetting price: err = %v, Offer = %v, want nil and nil", err, item.Offer)
+	}
+
+	if err = adapter.Set("price", 9.5); err != nil {
+		t.Fatal(err)
+	}
+	if item.Offer == nil || item.Price != 9.5 {
+		t.Errorf("Offer = %v, want the price 9.5", item.Offer)
+	}
+	if price, ok := adapter.Get("price"); !ok || price != 9.5 {
+		t.Errorf("Get(price) = %v, %v, want 9.5, true", price, ok)
+	}
+}
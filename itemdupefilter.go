@@ -0,0 +1,135 @@
+package spy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/ridewindx/spy/internal/set"
+	"github.com/sirupsen/logrus"
+	"os"
+	"strings"
+	"sync"
+)
+
+// DupeItemPipeline drops the items seen before, identified by the values of some of their fields,
+// or by a custom key function.
+// Like FingerprintDupeFilter, it can persist the seen keys into a file, to dedupe items across runs.
+type DupeItemPipeline struct {
+	// Fields whose values identify an item.
+	// Items missing any of them, i.e., not set, nil or zero, can't be identified and pass through.
+	Fields []string
+
+	// KeyFunc computes the key which identifies an item, or an empty key to let it pass through.
+	// If not nil, it takes precedence over the Fields.
+	KeyFunc func(item ItemAdapter) (string, error)
+
+	keys  *set.Set
+	file  *os.File
+	mutex sync.Mutex
+	*logrus.Logger
+	spider ISpider
+}
+
+func NewDupeItemPipeline(logger *logrus.Logger, fields []string, filename ...string) *DupeItemPipeline {
+	keys := set.NewSet()
+	var file *os.File
+	if len(filename) > 0 {
+		var err error
+		file, err = os.OpenFile(filename[0], os.O_RDWR|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			panic(err)
+		}
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			keys.Add(strings.TrimSpace(scanner.Text()))
+		}
+		err = scanner.Err()
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	return &DupeItemPipeline{
+		Fields: fields,
+		keys:   keys,
+		file:   file,
+		Logger: logger,
+	}
+}
+
+func (p *DupeItemPipeline) Open(spider ISpider) {
+	p.spider = spider
+}
+
+func (p *DupeItemPipeline) Close(spider ISpider) {
+	if p.file != nil {
+		p.file.Close()
+	}
+}
+
+func (p *DupeItemPipeline) ProcessItem(item interface{}, spider ISpider) (interface{}, error) {
+	adapter, err := NewItemAdapter(item)
+	if err != nil {
+		return nil, err
+	}
+	key, err := p.key(adapter)
+	if err != nil {
+		return nil, err
+	}
+	if key == "" {
+		spider.Crawler().Stats.Inc("itemdupefilter/unidentified")
+		return item, nil
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.keys.Contains(key) {
+		if p.Logger != nil {
+			p.WithFields(logrus.Fields{
+				"spider": spider,
+				"item":   item,
+			}).Debugf("Filtered duplicate item %v", item)
+		}
+		spider.Crawler().Stats.Inc("itemdupefilter/filtered")
+		return nil, &ItemDroppedError{Reason: "duplicate item"}
+	}
+
+	p.keys.Add(key)
+	if p.file != nil {
+		p.file.WriteString(key + "\n")
+	}
+	return item, nil
+}
+
+// key hashes the key of the item, so that it can be stored one per line whatever the field values.
+// It returns an empty key if a key field is missing, rather than hashing it as null, which would
+// make all such items duplicates.
+func (p *DupeItemPipeline) key(item ItemAdapter) (string, error) {
+	h := sha1.New()
+	if p.KeyFunc != nil {
+		key, err := p.KeyFunc(item)
+		if err != nil || key == "" {
+			return "", err
+		}
+		h.Write([]byte(key))
+	} else {
+		assert(len(p.Fields) > 0, "DupeItemPipeline needs either Fields or KeyFunc")
+		for _, field := range p.Fields {
+			if fieldMissing(item, field) {
+				return "", nil
+			}
+			value, _ := item.Get(field)
+			// JSON, rather than %v, so that equal values behind pointers hash the same
+			data, err := json.Marshal(value)
+			if err != nil {
+				return "", fmt.Errorf("key field %s: %s", field, err)
+			}
+			fmt.Fprintf(h, "%s=%s\x00", field, data)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
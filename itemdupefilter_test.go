@@ -0,0 +1,29 @@
+package spy
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDupeItemPipelineMissingKeyField(t *testing.T) {
+	spider := newTestSpider("dupes")
+	p := NewDupeItemPipeline(nil, []string{"sku"})
+	p.Open(spider)
+
+	items := []*Item{{"sku": "A-1"}, {"sku": "A-1"}, {"name": "no sku"}, {"sku": ""}, {"name": "no sku"}}
+	var dropped int
+	for _, item := range items {
+		if _, err := p.ProcessItem(item, spider); errors.Is(err, ErrItemDropped) {
+			dropped++
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if dropped != 1 {
+		t.Errorf("dropped %d items, want only the second A-1", dropped)
+	}
+	if n, _ := spider.crawler.Stats.Get("itemdupefilter/unidentified"); n != int64(3) {
+		t.Errorf("itemdupefilter/unidentified = %v, want 3", n)
+	}
+}
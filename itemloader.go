@@ -0,0 +1,339 @@
+package spy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InputProcessor processes the values extracted for a field, as soon as they are added to the loader.
+type InputProcessor func(values []interface{}) ([]interface{}, error)
+
+// OutputProcessor computes the final value of a field from all the values collected for it.
+// A nil value leaves the field out of the item.
+type OutputProcessor func(values []interface{}) (interface{}, error)
+
+type FieldProcessors struct {
+	Input  InputProcessor
+	Output OutputProcessor
+}
+
+// ItemLoaderSpec declares the processors of an item type.
+// It is meant to be declared once per item type and shared by all the loaders of that type.
+type ItemLoaderSpec struct {
+	// Item is a zero value of the struct item type, e.g., Product{}.
+	// If set, only the fields declared by its spy tags can be loaded.
+	Item interface{}
+
+	DefaultInput  InputProcessor  // defaults to Identity
+	DefaultOutput OutputProcessor // defaults to IdentityOutput
+	Fields        map[string]FieldProcessors
+}
+
+// Validate fails if processors are declared for fields unknown to the item type of the spec.
+func (spec *ItemLoaderSpec) Validate() error {
+	for field := range spec.Fields {
+		if err := spec.checkField(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkField fails if the field is not declared by the item type of the spec.
+func (spec *ItemLoaderSpec) checkField(field string) error {
+	if spec.Item == nil {
+		return nil
+	}
+	fields, err := ItemFields(spec.Item)
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		if f == field {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown field %s of item type %T", field, spec.Item)
+}
+
+func (spec *ItemLoaderSpec) input(field string) InputProcessor {
+	if fp, ok := spec.Fields[field]; ok && fp.Input != nil {
+		return fp.Input
+	}
+	if spec.DefaultInput != nil {
+		return spec.DefaultInput
+	}
+	return Identity
+}
+
+func (spec *ItemLoaderSpec) output(field string) OutputProcessor {
+	if fp, ok := spec.Fields[field]; ok && fp.Output != nil {
+		return fp.Output
+	}
+	if spec.DefaultOutput != nil {
+		return spec.DefaultOutput
+	}
+	return IdentityOutput
+}
+
+// itemValues holds the values collected by a loader and its nested loaders.
+type itemValues struct {
+	fields []string // in order of first addition
+	values map[string][]interface{}
+	err    error // first processing error
+}
+
+// ItemLoader populates an item with values extracted from a response,
+// passing them through the processors declared in its spec.
+type ItemLoader struct {
+	spec      *ItemLoaderSpec
+	selectors Selectors
+	item      *itemValues
+}
+
+func NewItemLoader(spec *ItemLoaderSpec, response *Response) *ItemLoader {
+	var selectors Selectors
+	if s := response.Selector(); s != nil {
+		selectors = Selectors{s}
+	}
+	return NewSelectorItemLoader(spec, selectors...)
+}
+
+func NewSelectorItemLoader(spec *ItemLoaderSpec, selectors ...Selector) *ItemLoader {
+	if spec == nil {
+		spec = &ItemLoaderSpec{}
+	}
+	return &ItemLoader{
+		spec:      spec,
+		selectors: selectors,
+		item: &itemValues{
+			values: make(map[string][]interface{}),
+			err:    spec.Validate(), // surfaces in LoadItem
+		},
+	}
+}
+
+// NestedCSS returns a loader whose queries are relative to the nodes selected by the CSS query.
+// Values added to the nested loader are loaded into the item of this loader.
+func (l *ItemLoader) NestedCSS(query string) *ItemLoader {
+	return &ItemLoader{l.spec, l.selectors.Select(query), l.item}
+}
+
+// NestedXPath returns a loader whose queries are relative to the nodes selected by the XPath query.
+// Values added to the nested loader are loaded into the item of this loader.
+func (l *ItemLoader) NestedXPath(query string) *ItemLoader {
+	return &ItemLoader{l.spec, l.selectors.XPath(query), l.item}
+}
+
+// AddCSS adds the texts selected by the CSS query to the field.
+// The given processors are applied before the input processor of the field.
+func (l *ItemLoader) AddCSS(field, query string, processors ...InputProcessor) {
+	l.addStrings(field, l.selectors.Select(query).Extract(), processors)
+}
+
+// AddXPath adds the texts selected by the XPath query to the field.
+// The given processors are applied before the input processor of the field.
+func (l *ItemLoader) AddXPath(field, query string, processors ...InputProcessor) {
+	l.addStrings(field, l.selectors.XPath(query).Extract(), processors)
+}
+
+// AddValue adds the value to the field. A slice value adds each of its elements.
+// The given processors are applied before the input processor of the field.
+func (l *ItemLoader) AddValue(field string, value interface{}, processors ...InputProcessor) {
+	var values []interface{}
+	switch v := value.(type) {
+	case nil:
+	case []interface{}:
+		values = v
+	case []string:
+		for _, s := range v {
+			values = append(values, s)
+		}
+	default:
+		values = []interface{}{v}
+	}
+	l.add(field, values, processors)
+}
+
+func (l *ItemLoader) addStrings(field string, strs []string, processors []InputProcessor) {
+	values := make([]interface{}, len(strs))
+	for i, s := range strs {
+		values[i] = s
+	}
+	l.add(field, values, processors)
+}
+
+func (l *ItemLoader) add(field string, values []interface{}, processors []InputProcessor) {
+	if l.item.err != nil {
+		return
+	}
+	if err := l.spec.checkField(field); err != nil {
+		l.item.err = err
+		return
+	}
+
+	processors = append(processors[:len(processors):len(processors)], l.spec.input(field))
+
+	var err error
+	for _, processor := range processors {
+		values, err = processor(values)
+		if err != nil {
+			l.item.err = fmt.Errorf("processing input of field %s: %s", field, err)
+			return
+		}
+	}
+
+	if _, ok := l.item.values[field]; !ok {
+		l.item.fields = append(l.item.fields, field)
+	}
+	l.item.values[field] = append(l.item.values[field], values...)
+}
+
+// Values returns the values collected for the field, before output processing.
+func (l *ItemLoader) Values(field string) []interface{} {
+	return l.item.values[field]
+}
+
+// LoadItem populates a new item with the output of the collected values of each field.
+// It returns the first error occurred while processing values.
+func (l *ItemLoader) LoadItem() (*Item, error) {
+	if l.item.err != nil {
+		return nil, l.item.err
+	}
+
+	item := make(Item)
+	for _, field := range l.item.fields {
+		value, err := l.spec.output(field)(l.item.values[field])
+		if err != nil {
+			return nil, fmt.Errorf("processing output of field %s: %s", field, err)
+		}
+		if value != nil {
+			item[field] = value
+		}
+	}
+	return &item, nil
+}
+
+// LoadInto sets the output of the collected values of each field to the fields of the item,
+// which is either an *Item or a pointer to a struct with spy tags.
+func (l *ItemLoader) LoadInto(item interface{}) error {
+	adapter, err := NewItemAdapter(item)
+	if err != nil {
+		return err
+	}
+
+	loaded, err := l.LoadItem()
+	if err != nil {
+		return err
+	}
+	for _, field := range l.item.fields {
+		if value, ok := (*loaded)[field]; ok {
+			if err = adapter.Set(field, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Identity returns the values unchanged.
+func Identity(values []interface{}) ([]interface{}, error) {
+	return values, nil
+}
+
+// IdentityOutput returns all the values as a slice, or nil if there is no value.
+func IdentityOutput(values []interface{}) (interface{}, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	return values, nil
+}
+
+// TakeFirst returns the first value which is neither nil nor an empty string.
+func TakeFirst(values []interface{}) (interface{}, error) {
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		if s, ok := v.(string); ok && s == "" {
+			continue
+		}
+		return v, nil
+	}
+	return nil, nil
+}
+
+// Join returns an output processor that joins the values with the separator.
+func Join(sep string) OutputProcessor {
+	return func(values []interface{}) (interface{}, error) {
+		strs := make([]string, len(values))
+		for i, v := range values {
+			strs[i] = fmt.Sprint(v)
+		}
+		return strings.Join(strs, sep), nil
+	}
+}
+
+// MapCompose returns an input processor that passes each value through the functions in turn.
+// A function returning nil drops the value, and the following functions are not called for it.
+func MapCompose(fns ...func(value interface{}) (interface{}, error)) InputProcessor {
+	return func(values []interface{}) ([]interface{}, error) {
+		var result []interface{}
+	Values:
+		for _, v := range values {
+			for _, fn := range fns {
+				var err error
+				v, err = fn(v)
+				if err != nil {
+					return nil, err
+				}
+				if v == nil {
+					continue Values
+				}
+			}
+			result = append(result, v)
+		}
+		return result, nil
+	}
+}
+
+// Strip removes leading and trailing whitespaces of a string value.
+func Strip(value interface{}) (interface{}, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("%v is not a string", value)
+	}
+	return strings.TrimSpace(s), nil
+}
+
+// ParseNumber parses a string value, e.g. "1,234.5", as float64.
+// Leading and trailing whitespaces and thousands separators are ignored.
+func ParseNumber(value interface{}) (interface{}, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("%v is not a string", value)
+	}
+	s = strings.Replace(strings.TrimSpace(s), ",", "", -1)
+	return strconv.ParseFloat(s, 64)
+}
+
+// ParseDate returns a function that parses a string value as time.Time,
+// trying the layouts in turn.
+func ParseDate(layouts ...string) func(value interface{}) (interface{}, error) {
+	return func(value interface{}) (interface{}, error) {
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v is not a string", value)
+		}
+		s = strings.TrimSpace(s)
+		for _, layout := range layouts {
+			t, err := time.Parse(layout, s)
+			if err == nil {
+				return t, nil
+			}
+		}
+		return nil, fmt.Errorf("date %q matches none of the layouts %v", s, layouts)
+	}
+}
@@ -0,0 +1,103 @@
+package spy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type loadedProduct struct {
+	Name     string    `spy:"name"`
+	Price    float64   `spy:"price"`
+	Tags     []string  `spy:"tags"`
+	Released time.Time `spy:"released"`
+}
+
+var productLoaderSpec = &ItemLoaderSpec{
+	Item:          loadedProduct{},
+	DefaultInput:  MapCompose(Strip),
+	DefaultOutput: TakeFirst,
+	Fields: map[string]FieldProcessors{
+		"price":    {Input: MapCompose(Strip, ParseNumber)},
+		"tags":     {Output: IdentityOutput},
+		"released": {Input: MapCompose(ParseDate("2006-01-02", "Jan 2, 2006"))},
+	},
+}
+
+const testProductPage = `<html><body>
+	<div class="product">
+		<h1>  Fountain pen </h1>
+		<span class="price"> 1,234.50 </span>
+		<ul class="tags"><li> ink </li><li>gift</li></ul>
+		<time>Mar 4, 2020</time>
+	</div>
+	<div class="related"><h1>Other pen</h1></div>
+</body></html>`
+
+func TestItemLoaderProcessors(t *testing.T) {
+	response := newTestResponse(t, "text/html; charset=utf-8", testProductPage)
+	loader := NewItemLoader(productLoaderSpec, response)
+	loader.AddCSS("name", "div.product h1")
+	loader.AddCSS("name", "div.related h1") // TakeFirst keeps the first one
+	loader.AddCSS("price", ".price")
+	loader.AddCSS("tags", ".tags li", MapCompose(func(v interface{}) (interface{}, error) {
+		return strings.ToUpper(v.(string)), nil
+	}))
+	loader.AddXPath("released", "//time")
+
+	var product loadedProduct
+	if err := loader.LoadInto(&product); err != nil {
+		t.Fatal(err)
+	}
+	want := loadedProduct{
+		Name:     "Fountain pen",
+		Price:    1234.5,
+		Tags:     []string{"INK", "GIFT"},
+		Released: time.Date(2020, 3, 4, 0, 0, 0, 0, time.UTC),
+	}
+	if !reflect.DeepEqual(product, want) {
+		t.Errorf("product = %+v, want %+v", product, want)
+	}
+}
+
+func TestItemLoaderNested(t *testing.T) {
+	response := newTestResponse(t, "text/html; charset=utf-8", testProductPage)
+	loader := NewItemLoader(&ItemLoaderSpec{DefaultInput: MapCompose(Strip), DefaultOutput: Join(", ")}, response)
+
+	product := loader.NestedCSS("div.product")
+	product.AddCSS("name", "h1") // relative to the product only
+	product.NestedXPath(".//ul").AddXPath("tags", "./li")
+	loader.AddValue("source", "test")
+
+	item, err := loader.LoadItem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Item{"name": "Fountain pen", "tags": "ink, gift", "source": "test"}
+	if !reflect.DeepEqual(item, want) {
+		t.Errorf("item = %v, want %v", item, want)
+	}
+}
+
+func TestItemLoaderErrors(t *testing.T) {
+	response := newTestResponse(t, "text/html; charset=utf-8", testProductPage)
+
+	loader := NewItemLoader(productLoaderSpec, response)
+	loader.AddCSS("price", "h1") // not a number
+	loader.AddCSS("name", "h1")
+	if _, err := loader.LoadItem(); err == nil || !strings.Contains(err.Error(), "field price") {
+		t.Errorf("err = %v, want the input error of price", err)
+	}
+
+	loader = NewItemLoader(productLoaderSpec, response)
+	loader.AddValue("color", "black")
+	if _, err := loader.LoadItem(); err == nil || !strings.Contains(err.Error(), "unknown field color") {
+		t.Errorf("err = %v, want an unknown field error", err)
+	}
+
+	spec := &ItemLoaderSpec{Item: loadedProduct{}, Fields: map[string]FieldProcessors{"color": {}}}
+	if err := spec.Validate(); err == nil {
+		t.Error("Validate() = nil for processors of an unknown field")
+	}
+}
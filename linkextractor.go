@@ -145,7 +145,7 @@ func (hle *HTMLLinkExtractor) ExtractLinks(response *Response) []*Link {
 	var selectors Selectors
 	if len(hle.RestrictSelectors) > 0 {
 		for _, rs := range hle.RestrictSelectors {
-			selectors = append(selectors, response.Select(rs))
+			selectors = append(selectors, response.Select(rs)...)
 		}
 		selectors = selectors.Select(hle.tags)
 	} else {
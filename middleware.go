@@ -1,7 +1,6 @@
 package spy
 
 import (
-	"github.com/ridewindx/crumb/concurrency"
 	"reflect"
 )
 
@@ -43,15 +42,15 @@ func (mm *MiddlewareManager) Register(middleware Middleware) {
 	mm.methods["OnSpiderClosed"] = append([]interface{}{middleware.OnSpiderClosed}, mm.methods["OnSpiderClosed"]...)
 }
 
-func (mm *MiddlewareManager) OnSpiderOpened(spider Spider) {
-	for m := range mm.methods["OnSpiderOpened"] {
-		m.(func(spider Spider))(spider)
+func (mm *MiddlewareManager) OnSpiderOpened(spider ISpider) {
+	for _, m := range mm.methods["OnSpiderOpened"] {
+		m.(func(spider ISpider))(spider)
 	}
 }
 
-func (mm *MiddlewareManager) OnSpiderClosed(spider Spider) {
-	for m := range mm.methods["OnSpiderClosed"] {
-		m.(func(spider Spider))(spider)
+func (mm *MiddlewareManager) OnSpiderClosed(spider ISpider) {
+	for _, m := range mm.methods["OnSpiderClosed"] {
+		m.(func(spider ISpider))(spider)
 	}
 }
 
@@ -62,7 +61,7 @@ func (mm *MiddlewareManager) addHandler(middleware Middleware, handlerName strin
 	if ok {
 		f := func(in []reflect.Value) reflect.Value {
 			in = append([]reflect.Value{v}, in...)
-			return m.Func.Call(in)
+			return m.Func.Call(in)[0]
 		}
 		if len(prepend) == 0 || !prepend[0] {
 			mm.methods[handlerName] = append(mm.methods[handlerName], f)
@@ -89,7 +88,7 @@ func (mm *MiddlewareManager) callHandlerIterator(handlerName string, object inte
 	}
 	return &MiddlewareManagerIterator{
 		args:    in,
-		methods: mm.methods(handlerName),
+		methods: mm.methods[handlerName],
 	}
 }
 
@@ -100,17 +99,17 @@ type MiddlewareManagerIterator struct {
 }
 
 func (mmi *MiddlewareManagerIterator) HasNext() bool {
-	return pos < len(in)
+	return mmi.pos < len(mmi.methods)
 }
 
 func (mmi *MiddlewareManagerIterator) Next() interface{} {
 	object := mmi.args[0].Interface()
 	if object == nil {
-		object = mmi.methods[pos].(func([]reflect.Value) reflect.Value)(mmi.args[1:]).Interface()
+		object = mmi.methods[mmi.pos].(func([]reflect.Value) reflect.Value)(mmi.args[1:]).Interface()
 	} else {
-		mmi.args[0] = mmi.methods[pos].(func([]reflect.Value) reflect.Value)(mmi.args)
+		mmi.args[0] = mmi.methods[mmi.pos].(func([]reflect.Value) reflect.Value)(mmi.args)
 		object = mmi.args[0].Interface()
 	}
-	pos++
+	mmi.pos++
 	return object
 }
@@ -1,39 +1,250 @@
 package spy
 
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
 type ItemPipelineMiddleware interface{}
 
+// ItemProcessor processes an item, which is either an *Item or a pointer to a struct with spy tags.
+// Use NewItemAdapter to access the fields of any item.
 type ItemProcessor interface {
-	ProcessItem(item *Item, spider ISpider) (*Item, error)
+	ProcessItem(item interface{}, spider ISpider) (interface{}, error)
+}
+
+// BatchItemProcessor processes items in batches, e.g., for bulk inserts into a database.
+// It returns the processed items in the same order, with nil for the items to drop.
+// An error fails all the items of the batch.
+type BatchItemProcessor interface {
+	ProcessItems(items []interface{}, spider ISpider) ([]interface{}, error)
+}
+
+// PipelineOptions configures how the manager runs an item pipeline middleware.
+type PipelineOptions struct {
+	// Concurrency is the maximum number of items, or batches, processed at the same time.
+	// Defaults to 1.
+	Concurrency int
+
+	// BatchSize is the maximum number of items of a batch, for a BatchItemProcessor.
+	// Defaults to 100.
+	BatchSize int
+
+	// FlushInterval is the maximum time an item waits for its batch to be full, for a BatchItemProcessor.
+	// Defaults to 1 second.
+	FlushInterval time.Duration
 }
 
+type itemTask struct {
+	item interface{}
+	done func(item interface{}, err error)
+}
+
+type pipelineStage struct {
+	processor      ItemProcessor
+	batchProcessor BatchItemProcessor
+	PipelineOptions
+	holders chan struct{} // concurrency slots
+
+	mutex sync.Mutex
+	batch []*itemTask
+	timer *time.Timer
+}
+
+// ItemPipelineManager passes the items through the registered middlewares asynchronously.
+// Every middleware processes items concurrently up to its own limit,
+// so that a slow middleware doesn't hold the other ones.
 type ItemPipelineManager struct {
-	middlewares    []ItemPipelineMiddleware
-	itemProcessors []ItemProcessor
+	// MaxInFlight is the maximum number of items in the pipelines before the crawler backs out.
+	// Zero means no limit.
+	MaxInFlight int
+
+	middlewares []interface{}
+	stages      []*pipelineStage
+	inFlight    int64
+	waitGroup   sync.WaitGroup
+	spider      ISpider
 }
 
-func (ipm *ItemPipelineManager) Register(middleware ItemPipelineMiddleware) {
+func (ipm *ItemPipelineManager) Register(middleware ItemPipelineMiddleware, options ...PipelineOptions) {
 	ipm.middlewares = append(ipm.middlewares, middleware)
 
-	if processor, ok := middleware.(ItemProcessor); ok {
-		ipm.itemProcessors = append(ipm.itemProcessors, processor)
+	var opts PipelineOptions
+	if len(options) > 0 {
+		opts = options[0]
 	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+
+	stage := &pipelineStage{
+		PipelineOptions: opts,
+		holders:         make(chan struct{}, opts.Concurrency),
+	}
+	if processor, ok := middleware.(BatchItemProcessor); ok {
+		stage.batchProcessor = processor
+	} else if processor, ok := middleware.(ItemProcessor); ok {
+		stage.processor = processor
+	} else {
+		return
+	}
+	ipm.stages = append(ipm.stages, stage)
 }
 
 func (ipm *ItemPipelineManager) Open(spider ISpider) {
+	ipm.spider = spider
 	openAll(spider, ipm.middlewares...)
 }
 
+// Close waits for the items in the pipelines, flushing partial batches, then closes the middlewares.
 func (ipm *ItemPipelineManager) Close(spider ISpider) {
+	ipm.Flush()
 	closeAll(spider, ipm.middlewares...)
 }
 
-func (ipm *ItemPipelineManager) ProcessItem(item *Item, spider ISpider) (*Item, error) {
-	var err error
-	for _, processor := range ipm.itemProcessors {
-		item, err = processor.ProcessItem(item, spider)
-		if err != nil {
-			return nil, err
+// Flush processes the partial batches, and waits until no item is left in the pipelines.
+// Items reaching a batch later are flushed by its timer.
+func (ipm *ItemPipelineManager) Flush() {
+	for i := range ipm.stages {
+		ipm.flushBatch(i)
+	}
+	ipm.waitGroup.Wait()
+}
+
+// InFlight returns the number of items in the pipelines.
+func (ipm *ItemPipelineManager) InFlight() int {
+	return int(atomic.LoadInt64(&ipm.inFlight))
+}
+
+// NeedsBackout reports whether the crawler should stop feeding items for now.
+func (ipm *ItemPipelineManager) NeedsBackout() bool {
+	return ipm.MaxInFlight > 0 && ipm.InFlight() >= ipm.MaxInFlight
+}
+
+// ProcessItemAsync passes the item through the pipelines, then calls done with the resulting item or error.
+func (ipm *ItemPipelineManager) ProcessItemAsync(item interface{}, spider ISpider, done func(item interface{}, err error)) {
+	atomic.AddInt64(&ipm.inFlight, 1)
+	ipm.waitGroup.Add(1)
+	ipm.process(0, &itemTask{
+		item: item,
+		done: func(item interface{}, err error) {
+			done(item, err)
+			atomic.AddInt64(&ipm.inFlight, -1)
+			ipm.waitGroup.Done()
+		},
+	})
+}
+
+// ProcessItem passes the item through the pipelines, and waits for the result.
+func (ipm *ItemPipelineManager) ProcessItem(item interface{}, spider ISpider) (interface{}, error) {
+	type result struct {
+		item interface{}
+		err  error
+	}
+	ch := make(chan result, 1)
+	ipm.ProcessItemAsync(item, spider, func(item interface{}, err error) {
+		ch <- result{item, err}
+	})
+	r := <-ch
+	return r.item, r.err
+}
+
+// process passes the task to the i-th stage, or finishes it past the last stage.
+// Items are abandoned once the context of the crawler is done.
+func (ipm *ItemPipelineManager) process(i int, task *itemTask) {
+	if i == len(ipm.stages) {
+		task.done(task.item, nil)
+		return
+	}
+	if err := spiderContext(ipm.spider).Err(); err != nil {
+		task.done(task.item, err)
+		return
+	}
+
+	stage := ipm.stages[i]
+	if stage.batchProcessor != nil {
+		stage.mutex.Lock()
+		stage.batch = append(stage.batch, task)
+		full := len(stage.batch) >= stage.BatchSize
+		if !full && stage.timer == nil {
+			stage.timer = time.AfterFunc(stage.FlushInterval, func() {
+				ipm.flushBatch(i)
+			})
+		}
+		stage.mutex.Unlock()
+		if full {
+			ipm.flushBatch(i)
 		}
+		return
+	}
+
+	// the slot is acquired in the goroutine, so that a slow stage doesn't block the scraping caller;
+	// MaxInFlight bounds the items waiting for a slot
+	go func() {
+		stage.holders <- struct{}{}
+		item, err := stage.processor.ProcessItem(task.item, ipm.spider)
+		<-stage.holders
+		ipm.next(i, task, item, err)
+	}()
+}
+
+func (ipm *ItemPipelineManager) flushBatch(i int) {
+	stage := ipm.stages[i]
+	if stage.batchProcessor == nil {
+		return
+	}
+
+	stage.mutex.Lock()
+	tasks := stage.batch
+	stage.batch = nil
+	if stage.timer != nil {
+		stage.timer.Stop()
+		stage.timer = nil
+	}
+	stage.mutex.Unlock()
+	if len(tasks) == 0 {
+		return
+	}
+
+	go func() {
+		stage.holders <- struct{}{}
+		items := make([]interface{}, len(tasks))
+		for j, task := range tasks {
+			items[j] = task.item
+		}
+		results, err := stage.batchProcessor.ProcessItems(items, ipm.spider)
+		<-stage.holders
+
+		for j, task := range tasks {
+			switch {
+			case err != nil:
+				ipm.next(i, task, nil, err)
+			case j >= len(results) || results[j] == nil:
+				ipm.next(i, task, nil, ErrItemDropped)
+			default:
+				ipm.next(i, task, results[j], nil)
+			}
+		}
+	}()
+}
+
+func (ipm *ItemPipelineManager) next(i int, task *itemTask, item interface{}, err error) {
+	if err != nil {
+		task.done(task.item, err) // report the item which failed
+		return
+	}
+	if item == nil {
+		task.done(task.item, errors.New("item processor returned no item"))
+		return
 	}
-	return item, nil
+	task.item = item
+	ipm.process(i+1, task)
 }
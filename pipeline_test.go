@@ -0,0 +1,178 @@
+package spy
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tracePipeline appends its mark to the trail of the items.
+type tracePipeline struct {
+	mark string
+}
+
+func (p *tracePipeline) ProcessItem(item interface{}, spider ISpider) (interface{}, error) {
+	it := item.(*Item)
+	(*it)["trail"] = (*it)["trail"].(string) + p.mark
+	return item, nil
+}
+
+// batchPipeline records its batches, and drops the items with a drop field.
+type batchPipeline struct {
+	mutex   sync.Mutex
+	batches [][]interface{}
+	err     error
+}
+
+func (p *batchPipeline) ProcessItems(items []interface{}, spider ISpider) ([]interface{}, error) {
+	p.mutex.Lock()
+	p.batches = append(p.batches, items)
+	p.mutex.Unlock()
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	results := make([]interface{}, len(items))
+	for i, item := range items {
+		it := item.(*Item)
+		if _, drop := (*it)["drop"]; !drop {
+			(*it)["trail"] = (*it)["trail"].(string) + "b"
+			results[i] = item
+		}
+	}
+	return results, nil
+}
+
+// blockingPipeline holds the items until released.
+type blockingPipeline struct {
+	release chan struct{}
+}
+
+func (p *blockingPipeline) ProcessItem(item interface{}, spider ISpider) (interface{}, error) {
+	<-p.release
+	return item, nil
+}
+
+type pipelineResults struct {
+	mutex sync.Mutex
+	items map[int]*Item
+	errs  map[int]error
+}
+
+func newPipelineResults() *pipelineResults {
+	return &pipelineResults{items: make(map[int]*Item), errs: make(map[int]error)}
+}
+
+func (r *pipelineResults) done(id int) func(item interface{}, err error) {
+	return func(item interface{}, err error) {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		r.items[id], r.errs[id] = item.(*Item), err
+	}
+}
+
+func TestItemPipelineManagerOrder(t *testing.T) {
+	spider := newTestSpider("pipeline")
+	batch := &batchPipeline{}
+	ipm := &ItemPipelineManager{}
+	ipm.Register(&tracePipeline{mark: "a"}, PipelineOptions{Concurrency: 4})
+	ipm.Register(batch, PipelineOptions{BatchSize: 5, FlushInterval: time.Hour})
+	ipm.Register(&tracePipeline{mark: "c"}, PipelineOptions{Concurrency: 4})
+	ipm.Open(spider)
+
+	results := newPipelineResults()
+	for i := 0; i < 10; i++ {
+		item := &Item{"id": i, "trail": ""}
+		if i == 3 {
+			(*item)["drop"] = true
+		}
+		ipm.ProcessItemAsync(item, spider, results.done(i))
+	}
+	ipm.Close(spider)
+
+	if n := ipm.InFlight(); n != 0 {
+		t.Errorf("InFlight() = %d after Close, want 0", n)
+	}
+	if len(batch.batches) != 2 {
+		t.Errorf("got %d batches, want 2 full ones", len(batch.batches))
+	}
+	for i := 0; i < 10; i++ {
+		trail := (*results.items[i])["trail"]
+		if i == 3 {
+			if !errors.Is(results.errs[i], ErrItemDropped) || trail != "a" {
+				t.Errorf("item 3: err = %v, trail = %v, want ErrItemDropped after a", results.errs[i], trail)
+			}
+			continue
+		}
+		if results.errs[i] != nil || trail != "abc" {
+			t.Errorf("item %d: err = %v, trail = %v, want the stages in order", i, results.errs[i], trail)
+		}
+	}
+}
+
+func TestItemPipelineManagerFlush(t *testing.T) {
+	spider := newTestSpider("pipeline")
+	batch := &batchPipeline{}
+	ipm := &ItemPipelineManager{}
+	ipm.Register(batch, PipelineOptions{BatchSize: 100, FlushInterval: time.Hour})
+	ipm.Open(spider)
+
+	results := newPipelineResults()
+	for i := 0; i < 3; i++ {
+		ipm.ProcessItemAsync(&Item{"id": i, "trail": ""}, spider, results.done(i))
+	}
+	if n := ipm.InFlight(); n != 3 {
+		t.Errorf("InFlight() = %d before Flush, want 3", n)
+	}
+	ipm.Flush() // the partial batch doesn't wait for the interval
+
+	if len(batch.batches) != 1 || len(batch.batches[0]) != 3 {
+		t.Fatalf("batches = %v, want one of 3 items", batch.batches)
+	}
+	for i := 0; i < 3; i++ {
+		if results.errs[i] != nil || (*results.items[i])["trail"] != "b" {
+			t.Errorf("item %d: err = %v, item = %v", i, results.errs[i], results.items[i])
+		}
+	}
+
+	// an error fails the whole batch
+	batch.err = errors.New("database is down")
+	for i := 0; i < 2; i++ {
+		ipm.ProcessItemAsync(&Item{"id": i, "trail": ""}, spider, results.done(i))
+	}
+	ipm.Flush()
+	for i := 0; i < 2; i++ {
+		if results.errs[i] != batch.err {
+			t.Errorf("item %d: err = %v, want %v", i, results.errs[i], batch.err)
+		}
+	}
+}
+
+func TestItemPipelineManagerBackout(t *testing.T) {
+	spider := newTestSpider("pipeline")
+	blocking := &blockingPipeline{release: make(chan struct{})}
+	ipm := &ItemPipelineManager{MaxInFlight: 3}
+	ipm.Register(blocking, PipelineOptions{Concurrency: 1})
+	ipm.Open(spider)
+
+	results := newPipelineResults()
+	for i := 0; i < 3; i++ {
+		if ipm.NeedsBackout() {
+			t.Fatalf("NeedsBackout() = true with %d items in flight", i)
+		}
+		ipm.ProcessItemAsync(&Item{"id": i}, spider, results.done(i))
+	}
+	if !ipm.NeedsBackout() {
+		t.Errorf("NeedsBackout() = false with %d items in flight", ipm.InFlight())
+	}
+
+	close(blocking.release)
+	ipm.Flush()
+	if ipm.NeedsBackout() || ipm.InFlight() != 0 {
+		t.Errorf("NeedsBackout() = %v, InFlight() = %d after Flush", ipm.NeedsBackout(), ipm.InFlight())
+	}
+	if len(results.items) != 3 {
+		t.Errorf("%d items done, want 3", len(results.items))
+	}
+}
@@ -0,0 +1,183 @@
+package spy
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	statsDesc = prometheus.NewDesc("spy_stats",
+		"Numeric stats of the spider, timestamps in Unix seconds.",
+		[]string{"spider", "crawler", "key"}, nil)
+	fetcherActiveDesc = prometheus.NewDesc("spy_fetcher_active_requests",
+		"Number of requests being fetched.",
+		[]string{"spider", "crawler"}, nil)
+	fetcherSlotDesc = prometheus.NewDesc("spy_fetcher_slot_occupancy",
+		"Number of requests being fetched per slot, i.e., domain or IP.",
+		[]string{"spider", "crawler", "slot"}, nil)
+	schedulerPendingDesc = prometheus.NewDesc("spy_scheduler_pending_requests",
+		"Number of requests waiting in the scheduler queue.",
+		[]string{"spider", "crawler"}, nil)
+	workPoolActiveDesc = prometheus.NewDesc("spy_workpool_active_jobs",
+		"Number of responses being scraped, or waiting for the work pool.",
+		[]string{"spider", "crawler"}, nil)
+	workPoolUtilizationDesc = prometheus.NewDesc("spy_workpool_utilization",
+		"Ratio of the active jobs to the concurrency of the work pool.",
+		[]string{"spider", "crawler"}, nil)
+	pipelineInFlightDesc = prometheus.NewDesc("spy_item_pipeline_in_flight",
+		"Number of items in the item pipelines.",
+		[]string{"spider", "crawler"}, nil)
+)
+
+// fetcherMetrics is implemented by fetchers reporting their occupancy, like Fetcher.
+type fetcherMetrics interface {
+	Active() int
+	SlotOccupancy() map[string]int
+}
+
+// PrometheusExporter is a crawler extension which exposes the stats and the load of crawlers
+// as Prometheus metrics, labeled by spider, on a local HTTP endpoint.
+// The same exporter can be added to several crawlers,
+// it serves while at least one of their spiders is open.
+// The crawler label tells apart the open crawlers of spiders with the same name: it is the lowest number
+// not taken by them, so that labels are reused, e.g., by the crawlers of a spider scheduled again and again.
+type PrometheusExporter struct {
+	Addr string // listening address, e.g., "127.0.0.1:9410"; port 0 picks a free port
+	Path string // defaults to "/metrics"
+
+	crawlers map[*Crawler]string // crawler label
+	registry *prometheus.Registry
+	listener net.Listener
+	server   *http.Server
+	mutex    sync.Mutex
+}
+
+func NewPrometheusExporter(addr string) *PrometheusExporter {
+	pe := &PrometheusExporter{
+		Addr:     addr,
+		Path:     "/metrics",
+		crawlers: make(map[*Crawler]string),
+		registry: prometheus.NewRegistry(),
+	}
+	pe.registry.MustRegister(pe)
+	return pe
+}
+
+func (pe *PrometheusExporter) Open(spider ISpider) {
+	pe.mutex.Lock()
+	defer pe.mutex.Unlock()
+
+	if _, ok := pe.crawlers[spider.Crawler()]; !ok {
+		pe.crawlers[spider.Crawler()] = pe.crawlerLabel(spider.String())
+	}
+	if pe.server != nil {
+		return
+	}
+
+	var err error
+	pe.listener, err = net.Listen("tcp", pe.Addr)
+	if err != nil {
+		panic(err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(pe.Path, promhttp.HandlerFor(pe.registry, promhttp.HandlerOpts{}))
+	pe.server = &http.Server{Handler: mux}
+	go pe.server.Serve(pe.listener)
+}
+
+// crawlerLabel returns the lowest number not taken by the open crawlers of spiders with the name.
+func (pe *PrometheusExporter) crawlerLabel(name string) string {
+	taken := make(map[string]bool)
+	for c, label := range pe.crawlers {
+		if c.Spider.String() == name {
+			taken[label] = true
+		}
+	}
+	for i := 1; ; i++ {
+		if label := strconv.Itoa(i); !taken[label] {
+			return label
+		}
+	}
+}
+
+func (pe *PrometheusExporter) Close(spider ISpider) {
+	pe.mutex.Lock()
+	defer pe.mutex.Unlock()
+
+	delete(pe.crawlers, spider.Crawler())
+	if len(pe.crawlers) == 0 && pe.server != nil {
+		pe.server.Close()
+		pe.server = nil
+		pe.listener = nil
+	}
+}
+
+// URL returns the URL of the metrics endpoint, or "" if it is not serving.
+func (pe *PrometheusExporter) URL() string {
+	pe.mutex.Lock()
+	defer pe.mutex.Unlock()
+	if pe.listener == nil {
+		return ""
+	}
+	return "http://" + pe.listener.Addr().String() + pe.Path
+}
+
+func (pe *PrometheusExporter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- statsDesc
+	ch <- fetcherActiveDesc
+	ch <- fetcherSlotDesc
+	ch <- schedulerPendingDesc
+	ch <- workPoolActiveDesc
+	ch <- workPoolUtilizationDesc
+	ch <- pipelineInFlightDesc
+}
+
+func (pe *PrometheusExporter) Collect(ch chan<- prometheus.Metric) {
+	pe.mutex.Lock()
+	crawlers := make(map[*Crawler]string, len(pe.crawlers))
+	for c, label := range pe.crawlers {
+		crawlers[c] = label
+	}
+	pe.mutex.Unlock()
+
+	for c, crawler := range crawlers {
+		spider := c.Spider.String()
+
+		for key, value := range c.Stats.GetAll() {
+			var f float64
+			switch v := value.(type) {
+			case int64:
+				f = float64(v)
+			case float64:
+				f = v
+			case time.Time:
+				f = float64(v.UnixNano()) / float64(time.Second)
+			default:
+				continue // strings
+			}
+			ch <- prometheus.MustNewConstMetric(statsDesc, prometheus.GaugeValue, f, spider, crawler, key)
+		}
+
+		if fm, ok := c.Fetcher.(fetcherMetrics); ok {
+			ch <- prometheus.MustNewConstMetric(fetcherActiveDesc, prometheus.GaugeValue, float64(fm.Active()), spider, crawler)
+			for slot, n := range fm.SlotOccupancy() {
+				ch <- prometheus.MustNewConstMetric(fetcherSlotDesc, prometheus.GaugeValue, float64(n), spider, crawler, slot)
+			}
+		}
+
+		ch <- prometheus.MustNewConstMetric(schedulerPendingDesc, prometheus.GaugeValue, float64(c.Scheduler.Pending()), spider, crawler)
+
+		scraping := float64(c.Scraping())
+		ch <- prometheus.MustNewConstMetric(workPoolActiveDesc, prometheus.GaugeValue, scraping, spider, crawler)
+		if c.Concurrency > 0 {
+			ch <- prometheus.MustNewConstMetric(workPoolUtilizationDesc, prometheus.GaugeValue, scraping/float64(c.Concurrency), spider, crawler)
+		}
+
+		ch <- prometheus.MustNewConstMetric(pipelineInFlightDesc, prometheus.GaugeValue, float64(c.ItemPipelineManager.InFlight()), spider, crawler)
+	}
+}
@@ -0,0 +1,62 @@
+package spy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPrometheusExporterScrape(t *testing.T) {
+	pe := NewPrometheusExporter("127.0.0.1:0")
+
+	// two crawlers of spiders with the same name
+	var spiders []*testSpider
+	for i := 0; i < 2; i++ {
+		spider := newTestSpider("shop")
+		spider.crawler.Scheduler = NewScheduler()
+		spider.crawler.ItemPipelineManager = &ItemPipelineManager{}
+		spider.crawler.Stats.Inc("item_scraped_count", int64(i+1))
+		spiders = append(spiders, spider)
+		pe.Open(spider)
+	}
+
+	resp, err := http.Get(pe.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, body:\n%s", resp.StatusCode, body)
+	}
+
+	for _, want := range []string{
+		`spy_stats{crawler="1",key="item_scraped_count",spider="shop"} 1`,
+		`spy_stats{crawler="2",key="item_scraped_count",spider="shop"} 2`,
+		`spy_scheduler_pending_requests{crawler="1",spider="shop"} 0`,
+		`spy_item_pipeline_in_flight{crawler="2",spider="shop"} 0`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("missing %s in:\n%s", want, body)
+		}
+	}
+
+	// the label of a closed crawler is reused
+	pe.Close(spiders[0])
+	spiders[0] = newTestSpider("shop")
+	pe.Open(spiders[0])
+	if label := pe.crawlers[spiders[0].crawler]; label != "1" {
+		t.Errorf("crawler label = %s, want 1 reused", label)
+	}
+
+	for _, spider := range spiders {
+		pe.Close(spider)
+	}
+	if u := pe.URL(); u != "" {
+		t.Errorf("URL = %q after closing all the spiders, want none", u)
+	}
+}
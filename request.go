@@ -5,7 +5,9 @@ import (
 	"net/http"
 	"net/url"
 	"sort"
-	"github.com/ridewindx/crumb/weakref"
+	"runtime"
+	"sync"
+	"weak"
 	"crypto/sha1"
 	"bufio"
 	"encoding/hex"
@@ -29,12 +31,24 @@ func NewRequest(urlStr, method string) *Request {
 	return req
 }
 
-var fingerprintCache = weakref.NewWeakPtrMap()
+// String returns the method and the URL of the request, e.g., for logging.
+func (req *Request) String() string {
+	if req.Request == nil {
+		return "<invalid request>"
+	}
+	return "<" + req.Method + " " + req.URL.String() + ">"
+}
 
-// Fingerprint returns a hash that uniquely identifies the request.
+// fingerprintCache maps weak pointers of the requests to their fingerprints,
+// which are deleted when the requests are garbage collected.
+var fingerprintCache sync.Map
+
+// Fingerprint returns a hash that uniquely identifies the request
+// by its method, scheme, host, canonical URL (see uniqueURL) and body.
 // Ignore all headers.
 func (req *Request) Fingerprint() string {
-	val, ok := fingerprintCache.Get(req)
+	key := weak.Make(req)
+	val, ok := fingerprintCache.Load(key)
 	if ok {
 		return val.(string)
 	} else {
@@ -42,16 +56,22 @@ func (req *Request) Fingerprint() string {
 
 		buf := bufio.NewWriterSize(h, 1024)
 		buf.WriteString(req.Method)
+		buf.WriteString(" " + req.URL.Scheme + "://" + req.URL.Host)
 		buf.WriteString(uniqueURL(req.URL, false))
-		body, err := req.GetBody()
-		if err != nil {
-			panic("request.GetBody returns error: "+err.Error())
+		if req.GetBody != nil { // nil without body
+			body, err := req.GetBody()
+			if err != nil {
+				panic("request.GetBody returns error: "+err.Error())
+			}
+			buf.ReadFrom(body)
+			body.Close()
 		}
-		buf.ReadFrom(body)
 		buf.Flush()
 
 		fingerprint := hex.EncodeToString(h.Sum(nil))
-		fingerprintCache.Put(req, fingerprint)
+		if _, loaded := fingerprintCache.LoadOrStore(key, fingerprint); !loaded {
+			runtime.AddCleanup(req, func(key weak.Pointer[Request]) { fingerprintCache.Delete(key) }, key)
+		}
 
 		return fingerprint
 	}
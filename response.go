@@ -1,15 +1,20 @@
 package spy
 
 import (
+	"bytes"
 	"encoding/json"
 	"encoding/xml"
 	"github.com/PuerkitoBio/goquery"
+	"github.com/antchfx/xmlquery"
 	"golang.org/x/net/html/charset"
 	"io"
 	"io/ioutil"
 	"mime"
 	"net/http"
 	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
 )
 
 const (
@@ -25,10 +30,13 @@ const (
 
 type Response struct {
 	*http.Response
-	reader io.Reader
+	body []byte
 
 	MediaType string
 	HTMLDoc   *goquery.Document
+	XMLDoc    *xmlquery.Node
+
+	xmlSelector *XMLSelector
 
 	/* Request which generated this response.
 		This attribute is assigned in the `Crawler`, after the response and the request have passed
@@ -47,26 +55,98 @@ type Response struct {
 	*Request
 }
 
+// NewResponse reads and closes the body of the HTTP response, which can then be read again.
 func NewResponse(hr *http.Response) (r *Response, err error) {
 	r = &Response{Response: hr}
 
-	r.MediaType, _, err = mime.ParseMediaType(r.ContentType())
+	r.body, err = ioutil.ReadAll(hr.Body)
+	hr.Body.Close()
+	hr.Body = ioutil.NopCloser(bytes.NewReader(r.body))
 	if err != nil {
 		return
 	}
 
-	r.reader, err = charset.NewReader(r.Response.Body, r.ContentType())
+	r.MediaType, _, err = mime.ParseMediaType(r.ContentType())
 	if err != nil {
 		return
 	}
 
+	var reader io.Reader
 	if r.MediaType == MIMEHTML {
-		r.HTMLDoc, err = goquery.NewDocumentFromReader(r.reader)
+		if reader, err = r.newReader(); err == nil {
+			r.HTMLDoc, err = goquery.NewDocumentFromReader(reader)
+		}
+	} else if isXMLMediaType(r.MediaType) {
+		if reader, err = r.newReader(); err == nil {
+			r.XMLDoc, err = xmlquery.Parse(reader)
+		}
 	}
 
 	return
 }
 
+// newReader returns a reader of the body, decoded to UTF-8 if the content is textual.
+func (r *Response) newReader() (io.Reader, error) {
+	if isTextMediaType(r.MediaType) && len(r.body) > 0 { // charset.NewReader fails on empty bodies
+		return charset.NewReader(bytes.NewReader(r.body), r.ContentType())
+	}
+	return bytes.NewReader(r.body), nil // binary content, e.g., images
+}
+
+// NewFileResponse returns a response of the URL with the content of the file,
+// whose media type is guessed from its extension, HTML by default.
+func NewFileResponse(rawurl, filename string) (*Response, error) {
+	body, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	request := NewRequest(rawurl, http.MethodGet)
+	if request.Error != nil {
+		return nil, request.Error
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(filename))
+	if contentType == "" {
+		contentType = MIMEHTML + "; charset=utf-8"
+	}
+	hr := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Content-Type": {contentType}},
+		Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		Request:    request.Request,
+	}
+	r, err := NewResponse(hr)
+	if err != nil {
+		return nil, err
+	}
+	r.Request = request
+	return r, nil
+}
+
+func isTextMediaType(mediaType string) bool {
+	return strings.HasPrefix(mediaType, "text/") || mediaType == MIMEJSON || isXMLMediaType(mediaType)
+}
+
+// isXMLMediaType also accepts XML based media types, e.g., application/rss+xml.
+func isXMLMediaType(mediaType string) bool {
+	return mediaType == MIMEXML || mediaType == MIMEXMLText || strings.HasSuffix(mediaType, "+xml")
+}
+
+// String returns the status and the URL of the response, e.g., for logging.
+func (r *Response) String() string {
+	u := ""
+	if r.Response.Request != nil {
+		u = r.Response.Request.URL.String()
+	} else if r.Request != nil && r.Request.Request != nil {
+		u = r.Request.URL.String()
+	}
+	return "<" + strconv.Itoa(r.StatusCode) + " " + u + ">"
+}
+
 func (r *Response) ContentType() string {
 	return r.Response.Header.Get("Content-Type")
 }
@@ -75,8 +155,22 @@ func (r *Response) Close() {
 	r.Response.Body.Close()
 }
 
+// RawBody returns the body as received.
+func (r *Response) RawBody() []byte {
+	return r.body
+}
+
+// Bytes returns the body, decoded to UTF-8 if the content is textual.
+func (r *Response) Bytes() ([]byte, error) {
+	reader, err := r.newReader()
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(reader)
+}
+
 func (r *Response) Text() (text string, err error) {
-	bytes, err := ioutil.ReadAll(r.reader)
+	bytes, err := r.Bytes()
 	if err == nil {
 		text = string(bytes)
 	}
@@ -84,19 +178,52 @@ func (r *Response) Text() (text string, err error) {
 }
 
 func (r *Response) XML(v interface{}) error {
-	return xml.NewDecoder(r.reader).Decode(v)
+	reader, err := r.newReader()
+	if err != nil {
+		return err
+	}
+	return xml.NewDecoder(reader).Decode(v)
 }
 
 func (r *Response) JSON(v interface{}) error {
-	return json.NewDecoder(r.reader).Decode(v)
+	reader, err := r.newReader()
+	if err != nil {
+		return err
+	}
+	return json.NewDecoder(reader).Decode(v)
 }
 
+// Selector returns the root selector of the HTML or XML document,
+// or nil if the response is neither.
+// The selector of an XML response is an *XMLSelector, on which namespaces can be registered.
 func (r *Response) Selector() Selector {
-	return NewGoquerySelector(r.HTMLDoc)
+	if r.xmlSelector != nil {
+		return r.xmlSelector
+	}
+	if r.XMLDoc != nil {
+		r.xmlSelector = NewXMLSelector(r.XMLDoc) // keep registered namespaces
+		return r.xmlSelector
+	}
+	if r.HTMLDoc != nil {
+		return NewGoquerySelector(r.HTMLDoc)
+	}
+	return nil
 }
 
 func (r *Response) Select(query string) Selectors {
-	return r.Selector().Select(query)
+	s := r.Selector()
+	if s == nil {
+		return nil
+	}
+	return s.Select(query)
+}
+
+func (r *Response) XPath(query string) Selectors {
+	s := r.Selector()
+	if s == nil {
+		return nil
+	}
+	return s.XPath(query)
 }
 
 func (r *Response) getBaseUrl() *url.URL {
@@ -0,0 +1,225 @@
+package spy
+
+import (
+	"context"
+	"github.com/spf13/viper"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+)
+
+// CrawlerRunner runs several crawlers in the same process.
+type CrawlerRunner struct {
+	// Config is given to the crawlers without a config, shared by them, or copied if IsolateConfig.
+	Config        *Config
+	IsolateConfig bool
+
+	// Concurrency is the maximum number of crawlers running at a time, the others wait in order.
+	// One runs them sequentially, zero runs them all concurrently.
+	Concurrency int
+
+	// MaxRequests is the maximum number of requests being fetched at a time, across the crawlers.
+	// Zero is unlimited.
+	MaxRequests int
+
+	// HandleSignals makes Join stop the crawlers gracefully on SIGINT or SIGTERM,
+	// and immediately on a second signal.
+	HandleSignals bool
+
+	crawlers  []*Crawler
+	slots     chan struct{} // running crawlers
+	requests  chan struct{} // requests being fetched
+	stopped   chan struct{}
+	forced    bool
+	errs      CrawlErrors
+	waitGroup sync.WaitGroup
+	mutex     sync.Mutex
+}
+
+func NewCrawlerRunner(config *Config) *CrawlerRunner {
+	return &CrawlerRunner{
+		Config:        config,
+		HandleSignals: true,
+		stopped:       make(chan struct{}),
+	}
+}
+
+// CrawlErrors are the errors of the crawlers of a CrawlerRunner.
+type CrawlErrors []error
+
+func (e CrawlErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Crawl runs the crawler as soon as the concurrency of the runner allows it, without waiting.
+// The crawler doesn't handle signals itself, see Join.
+func (r *CrawlerRunner) Crawl(ctx context.Context, crawler *Crawler) {
+	r.mutex.Lock()
+	if r.Concurrency > 0 && r.slots == nil {
+		r.slots = make(chan struct{}, r.Concurrency)
+	}
+	if r.MaxRequests > 0 && r.requests == nil {
+		r.requests = make(chan struct{}, r.MaxRequests)
+	}
+	if crawler.Config == nil {
+		crawler.Config = r.crawlerConfig()
+	}
+	crawler.HandleSignals = false
+	crawler.requestBudget = r.requests
+	r.crawlers = append(r.crawlers, crawler)
+	r.waitGroup.Add(1)
+	r.mutex.Unlock()
+
+	go func() {
+		defer r.waitGroup.Done()
+
+		if r.slots != nil {
+			select {
+			case r.slots <- struct{}{}:
+				defer func() { <-r.slots }()
+			case <-ctx.Done():
+				r.addError(&CrawlError{Spider: crawler.Spider.String(), Reason: FinishReasonCanceled, Err: ctx.Err()})
+				return
+			case <-r.stopped:
+				r.addError(&CrawlError{Spider: crawler.Spider.String(), Reason: FinishReasonShutdown})
+				return
+			}
+		}
+
+		select {
+		case <-r.stopped: // stopped while waiting
+			r.addError(&CrawlError{Spider: crawler.Spider.String(), Reason: FinishReasonShutdown})
+			return
+		default:
+		}
+
+		// a stop landing while the crawler starts finds it not crawling yet, so check again once started
+		sub, _ := crawler.Events.OnCrawlerStarted(r.crawlerStarted)
+		defer crawler.Events.Unsub(sub)
+
+		if err := crawler.Run(ctx); err != nil {
+			r.addError(err)
+		}
+	}()
+}
+
+func (r *CrawlerRunner) crawlerStarted(crawler *Crawler) error {
+	r.mutex.Lock()
+	forced := r.forced
+	r.mutex.Unlock()
+
+	select {
+	case <-r.stopped:
+		if forced {
+			crawler.ForceStop()
+		} else {
+			crawler.CloseSpider(FinishReasonShutdown)
+		}
+	default:
+	}
+	return nil
+}
+
+// crawlerConfig returns the config of the runner, or a copy of it if IsolateConfig.
+func (r *CrawlerRunner) crawlerConfig() *Config {
+	if r.Config == nil || !r.IsolateConfig {
+		return r.Config
+	}
+
+	config := *r.Config
+	if r.Config.Viper != nil {
+		config.Viper = viper.New()
+		for _, key := range r.Config.AllKeys() {
+			config.Set(key, r.Config.Get(key))
+		}
+	}
+	return &config
+}
+
+func (r *CrawlerRunner) addError(err error) {
+	r.mutex.Lock()
+	r.errs = append(r.errs, err)
+	r.mutex.Unlock()
+}
+
+// Crawlers returns the crawlers given to Crawl.
+func (r *CrawlerRunner) Crawlers() []*Crawler {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]*Crawler(nil), r.crawlers...)
+}
+
+// Join waits for all the crawlers to stop, and returns their errors as CrawlErrors, if any.
+func (r *CrawlerRunner) Join() error {
+	if r.HandleSignals {
+		done := make(chan struct{})
+		defer close(done)
+		r.handleSignals(done)
+	}
+
+	r.waitGroup.Wait()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if len(r.errs) == 0 {
+		return nil
+	}
+	return r.errs
+}
+
+// Stop stops the running crawlers gracefully, and the waiting ones before they start.
+func (r *CrawlerRunner) Stop() {
+	r.stop(false)
+}
+
+// ForceStop stops the running crawlers immediately, and the waiting ones before they start.
+func (r *CrawlerRunner) ForceStop() {
+	r.stop(true)
+}
+
+func (r *CrawlerRunner) stop(force bool) {
+	r.mutex.Lock()
+	select {
+	case <-r.stopped:
+	default:
+		close(r.stopped)
+	}
+	r.forced = r.forced || force
+	crawlers := append([]*Crawler(nil), r.crawlers...)
+	r.mutex.Unlock()
+
+	for _, c := range crawlers {
+		if force {
+			c.ForceStop()
+		} else {
+			c.CloseSpider(FinishReasonShutdown)
+		}
+	}
+}
+
+func (r *CrawlerRunner) handleSignals(done <-chan struct{}) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, shutdownSignals...)
+
+	go func() {
+		defer signal.Stop(signals)
+
+		select {
+		case <-signals:
+			r.Stop()
+		case <-done:
+			return
+		}
+
+		select {
+		case <-signals:
+			r.ForceStop()
+		case <-done:
+		}
+	}()
+}
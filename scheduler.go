@@ -1,14 +1,19 @@
 package spy
 
+import "sync"
+
 type IScheduler interface {
 	Opener
 	Closer
 	EnqueueRequest(request *Request) bool
 	NextRequest() *Request
+	Pending() int
 }
 
 type Scheduler struct {
 	dupeFilter DupeFilter
+	queue      []*Request
+	mutex      sync.Mutex
 }
 
 func NewScheduler() *Scheduler {
@@ -16,22 +21,43 @@ func NewScheduler() *Scheduler {
 }
 
 func (s *Scheduler) Open(spider ISpider) {
-	s.dupeFilter.Open(spider)
+	if s.dupeFilter != nil {
+		s.dupeFilter.Open(spider)
+	}
 }
 
 func (s *Scheduler) Close(spider ISpider) {
-	s.dupeFilter.Close(spider)
+	if s.dupeFilter != nil {
+		s.dupeFilter.Close(spider)
+	}
 }
 
 func (s *Scheduler) EnqueueRequest(request *Request) bool {
-	if !request.NotFilter && s.dupeFilter.SeenRequest(request) {
+	if !request.NotFilter && s.dupeFilter != nil && s.dupeFilter.SeenRequest(request) {
 		return false
 	}
 
-
-
+	s.mutex.Lock()
+	s.queue = append(s.queue, request)
+	s.mutex.Unlock()
+	return true
 }
 
 func (s *Scheduler) NextRequest() *Request {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.queue) == 0 {
+		return nil
+	}
+	request := s.queue[0]
+	s.queue[0] = nil
+	s.queue = s.queue[1:]
+	return request
+}
 
+// Pending returns the number of requests waiting in the queue.
+func (s *Scheduler) Pending() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.queue)
 }
@@ -2,13 +2,22 @@ package spy
 
 import (
 	"github.com/PuerkitoBio/goquery"
+	"github.com/antchfx/htmlquery"
+	"golang.org/x/net/html"
 	"regexp"
+	"strings"
 )
 
 type Selector interface {
+	// Select selects nodes by a CSS query, which can end with the pseudo-element
+	// ::text, selecting the text children of the matched nodes,
+	// or ::attr(name), selecting the named attribute values of the matched nodes.
 	Select(query string) Selectors
+	XPath(query string) Selectors
 	Regex(regex interface{}) []string
 	Extract() string
+	ExtractHTML() string
+	ExtractOuterHTML() string
 	Attr(attrName string) (val string, exists bool)
 }
 
@@ -22,6 +31,14 @@ func (ss Selectors) Select(query string) Selectors {
 	return result
 }
 
+func (ss Selectors) XPath(query string) Selectors {
+	var result Selectors
+	for _, s := range ss {
+		result = append(result, s.XPath(query)...)
+	}
+	return result
+}
+
 func (ss Selectors) Regex(regex interface{}) []string {
 	re := getRegex(regex)
 
@@ -48,25 +65,113 @@ func (ss Selectors) Attrs(attrName string) []string {
 	for _, s := range ss {
 		val, exists := s.Attr(attrName)
 		if exists {
-			result = append(val, exists)
+			result = append(result, val)
 		}
 	}
 	return result
 }
 
-func (ss Selectors) Extract() []string {
+// ExtractOption post-processes an extracted string.
+type ExtractOption func(s string) string
+
+var (
+	// StripSpace removes leading and trailing whitespaces.
+	StripSpace ExtractOption = strings.TrimSpace
+
+	// NormalizeSpace strips leading and trailing whitespaces,
+	// and replaces sequences of whitespaces by a single space, like XPath normalize-space().
+	NormalizeSpace ExtractOption = func(s string) string {
+		return strings.Join(strings.Fields(s), " ")
+	}
+)
+
+func applyExtractOptions(s string, options []ExtractOption) string {
+	for _, option := range options {
+		s = option(s)
+	}
+	return s
+}
+
+func (ss Selectors) Extract(options ...ExtractOption) []string {
 	var result []string
 	for _, s := range ss {
-		result = append(result, s.Extract())
+		result = append(result, applyExtractOptions(s.Extract(), options))
 	}
 	return result
 }
 
-func (ss Selectors) ExtractFirst() string {
+func (ss Selectors) ExtractFirst(options ...ExtractOption) string {
+	return ss.ExtractFirstOr("", options...)
+}
+
+// ExtractFirstOr returns the text of the first selector, or the default value if there is no selector.
+func (ss Selectors) ExtractFirstOr(defaultValue string, options ...ExtractOption) string {
 	for _, s := range ss {
-		return s.Extract()
+		return applyExtractOptions(s.Extract(), options)
 	}
-	return ""
+	return defaultValue
+}
+
+func (ss Selectors) ExtractHTML() []string {
+	var result []string
+	for _, s := range ss {
+		result = append(result, s.ExtractHTML())
+	}
+	return result
+}
+
+func (ss Selectors) ExtractOuterHTML() []string {
+	var result []string
+	for _, s := range ss {
+		result = append(result, s.ExtractOuterHTML())
+	}
+	return result
+}
+
+// splitPseudoElement splits the pseudo-element ::text or ::attr(name) from the end of a CSS query.
+func splitPseudoElement(query string) (css, pseudo, attrName string) {
+	query = strings.TrimSpace(query)
+	if strings.HasSuffix(query, "::text") {
+		return strings.TrimSpace(strings.TrimSuffix(query, "::text")), "text", ""
+	}
+	if strings.HasSuffix(query, ")") {
+		if i := strings.LastIndex(query, "::attr("); i >= 0 {
+			attrName = strings.TrimSpace(query[i+len("::attr(") : len(query)-1])
+			return strings.TrimSpace(query[:i]), "attr", attrName
+		}
+	}
+	return query, "", ""
+}
+
+// TextSelector is the selector of a text or attribute value, which has no child.
+type TextSelector string
+
+func (ts TextSelector) Select(query string) Selectors {
+	return nil
+}
+
+func (ts TextSelector) XPath(query string) Selectors {
+	return nil
+}
+
+func (ts TextSelector) Regex(regex interface{}) []string {
+	return regexExtract(getRegex(regex), string(ts))
+}
+
+func (ts TextSelector) Extract() string {
+	return string(ts)
+}
+
+func (ts TextSelector) ExtractHTML() string {
+	return html.EscapeString(string(ts))
+}
+
+func (ts TextSelector) ExtractOuterHTML() string {
+	return html.EscapeString(string(ts))
+}
+
+func (ts TextSelector) Attr(attrName string) (val string, exists bool) {
+	return "", false
 }
 
 type GoquerySelector struct {
@@ -80,19 +185,58 @@ func NewGoquerySelector(doc *goquery.Document) *GoquerySelector {
 }
 
 func (gs *GoquerySelector) Select(query string) Selectors {
-	s := gs.Find(query)
-	var result = make(Selectors, s.Length())
-	for i := range result {
-		result[i] = GoquerySelector{s.Eq(i)}
+	css, pseudo, attrName := splitPseudoElement(query)
+	s := gs.Selection
+	if css != "" {
+		s = gs.Find(css)
+	}
+
+	var result Selectors
+	switch pseudo {
+	case "text":
+		for _, node := range s.Nodes {
+			for c := node.FirstChild; c != nil; c = c.NextSibling {
+				if c.Type == html.TextNode {
+					result = append(result, TextSelector(c.Data))
+				}
+			}
+		}
+	case "attr":
+		for i := range s.Nodes {
+			if val, exists := s.Eq(i).Attr(attrName); exists {
+				result = append(result, TextSelector(val))
+			}
+		}
+	default:
+		result = make(Selectors, s.Length())
+		for i := range result {
+			result[i] = &GoquerySelector{s.Eq(i)}
+		}
+	}
+	return result
+}
+
+func (gs *GoquerySelector) XPath(query string) Selectors {
+	var result Selectors
+	for _, node := range gs.Nodes {
+		nodes, err := htmlquery.QueryAll(node, query)
+		if err != nil {
+			panic("invalid xpath '" + query + "': " + err.Error())
+		}
+		for _, n := range nodes {
+			result = append(result, &GoquerySelector{goquery.NewDocumentFromNode(n).Selection})
+		}
 	}
 	return result
 }
 
 func (gs *GoquerySelector) Regex(regex interface{}) []string {
-	re := getRegex(regex)
+	return regexExtract(getRegex(regex), gs.Extract())
+}
 
+func regexExtract(re *regexp.Regexp, text string) []string {
 	var result []string
-	for _, slice := range re.FindAllStringSubmatch(gs.Extract(), -1) {
+	for _, slice := range re.FindAllStringSubmatch(text, -1) {
 		if len(slice) == 1 {
 			result = append(result, slice[0]) // the whole match, no submatch
 		} else {
@@ -102,13 +246,30 @@ func (gs *GoquerySelector) Regex(regex interface{}) []string {
 	return result
 }
 
+// Extract returns the combined text of the selected nodes and their descendants.
+// HTML entities are already unescaped by the parser.
 func (gs *GoquerySelector) Extract() string {
-	// TODO: html.UnescapeString
 	return gs.Text()
 }
 
+func (gs *GoquerySelector) ExtractHTML() string {
+	h, err := gs.Html()
+	if err != nil {
+		return ""
+	}
+	return h
+}
+
+func (gs *GoquerySelector) ExtractOuterHTML() string {
+	h, err := goquery.OuterHtml(gs.Selection)
+	if err != nil {
+		return ""
+	}
+	return h
+}
+
 func (gs *GoquerySelector) Attr(attrName string) (val string, exists bool) {
-	return gs.Attr(attrName)
+	return gs.Selection.Attr(attrName)
 }
 
 func getRegex(regex interface{}) *regexp.Regexp {
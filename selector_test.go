@@ -0,0 +1,38 @@
+package spy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHTMLPseudoElements(t *testing.T) {
+	response := newTestResponse(t, "text/html; charset=utf-8", `<html><body>
+		<ul>
+			<li><a href="/a" title="First">  A <b>bold</b> link </a></li>
+			<li><a href="/b">B</a></li>
+			<li><a>no link</a></li>
+		</ul></body></html>`)
+
+	if got := response.Select("li a::attr(href)").Extract(); !reflect.DeepEqual(got, []string{"/a", "/b"}) {
+		t.Errorf("::attr(href) = %q, want only the links with href", got)
+	}
+	if got := response.Select("li a::attr( title )").ExtractFirst(); got != "First" {
+		t.Errorf("::attr( title ) = %q, want First", got)
+	}
+	// ::text selects the direct text nodes only
+	if got := response.Select("li:first-child a::text").Extract(StripSpace); !reflect.DeepEqual(got, []string{"A", "link"}) {
+		t.Errorf("::text = %q, want [A link]", got)
+	}
+	if got := response.Select("li:first-child a").ExtractFirst(NormalizeSpace); got != "A bold link" {
+		t.Errorf("ExtractFirst(NormalizeSpace) = %q, want %q", got, "A bold link")
+	}
+	if got := response.Select("li a::attr(rel)").ExtractFirstOr("none"); got != "none" {
+		t.Errorf("ExtractFirstOr = %q, want the default", got)
+	}
+
+	// pseudo-elements apply to the selected nodes, or to the node itself without query
+	links := response.Select("li a")
+	if got := links.Select("::attr(href)").Extract(); !reflect.DeepEqual(got, []string{"/a", "/b"}) {
+		t.Errorf("Select(li a).Select(::attr(href)) = %q", got)
+	}
+}
@@ -1,12 +1,16 @@
 package spy
 
-import "time"
+import (
+	"net/url"
+	"strings"
+	"time"
+)
 
 type Item map[string]interface{}
 
 type SpiderResult struct {
 	Requests []*Request
-	Items    []*Item
+	Items    []interface{} // *Item or pointers to structs with spy tags, see ItemAdapter
 }
 
 func (sr *SpiderResult) Empty() bool {
@@ -22,12 +26,24 @@ type ISpider interface {
 	Crawler() *Crawler
 }
 
+// CrawlerSetter is implemented by spiders which keep the crawler returned by their Crawler method.
+// NewCrawler binds such a spider to the crawler it creates.
+type CrawlerSetter interface {
+	SetCrawler(crawler *Crawler)
+}
+
 type Spider struct {
 	Name      string
 	StartURLs []string
+
+	// AllowedDomains are the domains handled by the spider, including their subdomains.
+	// If empty, the domains of StartURLs are used.
+	AllowedDomains []string
+
+	crawler *Crawler
 }
 
-func (s *Spider) StartResusts() []*Request {
+func (s *Spider) StartRequests() []*Request {
 	reqs := make([]*Request, len(s.StartURLs))
 	for i, url := range s.StartURLs {
 		reqs[i] = NewRequest(url, "")
@@ -39,16 +55,55 @@ func (s *Spider) Parse(response *Response) (*SpiderResult, error) {
 	panic("not implemented")
 }
 
+// FetchDelay returns zero, so the delay of the fetcher applies.
+func (s *Spider) FetchDelay() time.Duration {
+	return 0
+}
+
+// ConcurrentRequests returns zero, so the slot concurrency of the fetcher applies.
+func (s *Spider) ConcurrentRequests() int {
+	return 0
+}
+
 func (s *Spider) String() string {
 	return s.Name
 }
 
+func (s *Spider) Crawler() *Crawler {
+	return s.crawler
+}
+
+func (s *Spider) SetCrawler(crawler *Crawler) {
+	s.crawler = crawler
+}
+
+// HandlesURL returns whether the host of the URL is one of the allowed domains, or a subdomain.
+func (s *Spider) HandlesURL(u *url.URL) bool {
+	domains := s.AllowedDomains
+	if len(domains) == 0 {
+		for _, start := range s.StartURLs {
+			if su, err := url.Parse(start); err == nil && su.Hostname() != "" {
+				domains = append(domains, su.Hostname())
+			}
+		}
+	}
+
+	host := strings.ToLower(u.Hostname())
+	for _, domain := range domains {
+		domain = strings.ToLower(domain)
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
 type CrawlSpider struct {
 	*Spider
 }
 
 func (s *CrawlSpider) Parse(response *Response) (*SpiderResult, error) {
-
+	return nil, nil // TODO: follow the rules
 }
 
 type Rule struct {
@@ -0,0 +1,39 @@
+package spy
+
+import "time"
+
+// testSpider is a spider without requests, bound to a crawler with in-memory stats.
+type testSpider struct {
+	name    string
+	crawler *Crawler
+}
+
+func newTestSpider(name string) *testSpider {
+	s := &testSpider{name: name}
+	s.crawler = &Crawler{Spider: s, Stats: NewStats(name), Events: NewEventBus()}
+	return s
+}
+
+func (s *testSpider) StartRequests() []*Request {
+	return nil
+}
+
+func (s *testSpider) Parse(response *Response) (*SpiderResult, error) {
+	return nil, nil
+}
+
+func (s *testSpider) FetchDelay() time.Duration {
+	return 0
+}
+
+func (s *testSpider) ConcurrentRequests() int {
+	return 0
+}
+
+func (s *testSpider) String() string {
+	return s.name
+}
+
+func (s *testSpider) Crawler() *Crawler {
+	return s.crawler
+}
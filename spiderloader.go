@@ -0,0 +1,107 @@
+package spy
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+)
+
+var (
+	ErrSpiderNotFound  = errors.New("spider not found")
+	ErrDuplicateSpider = errors.New("duplicate spider name")
+)
+
+// SpiderFactory returns a new instance of a spider.
+type SpiderFactory func() ISpider
+
+// URLHandler is implemented by spiders which tell the URLs they handle, like Spider.
+type URLHandler interface {
+	HandlesURL(u *url.URL) bool
+}
+
+// SpiderLoader is a registry of spiders by name, i.e., the String of the spider.
+type SpiderLoader struct {
+	factories map[string]SpiderFactory
+	mutex     sync.RWMutex
+}
+
+func NewSpiderLoader() *SpiderLoader {
+	return &SpiderLoader{
+		factories: make(map[string]SpiderFactory),
+	}
+}
+
+// DefaultSpiderLoader holds the spiders registered with Register.
+var DefaultSpiderLoader = NewSpiderLoader()
+
+// Register registers a spider with DefaultSpiderLoader, usually from an init function.
+// It panics if the name of the spider is empty or already registered.
+func Register(factory func() ISpider) {
+	if err := DefaultSpiderLoader.Register(factory); err != nil {
+		panic(err)
+	}
+}
+
+// Register registers a spider by the name of the instance it returns.
+func (l *SpiderLoader) Register(factory SpiderFactory) error {
+	if factory == nil {
+		return errors.New("nil spider factory")
+	}
+	name := factory().String()
+	if name == "" {
+		return errors.New("spider without a name")
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if _, ok := l.factories[name]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateSpider, name)
+	}
+	l.factories[name] = factory
+	return nil
+}
+
+// List returns the sorted names of the spiders.
+func (l *SpiderLoader) List() []string {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	names := make([]string, 0, len(l.factories))
+	for name := range l.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Load returns a new instance of the spider with the name.
+func (l *SpiderLoader) Load(name string) (ISpider, error) {
+	l.mutex.RLock()
+	factory, ok := l.factories[name]
+	l.mutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSpiderNotFound, name)
+	}
+	return factory(), nil
+}
+
+// FindByURL returns the sorted names of the spiders handling the URL, see URLHandler.
+func (l *SpiderLoader) FindByURL(rawurl string) ([]string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, name := range l.List() {
+		spider, err := l.Load(name)
+		if err != nil {
+			continue // unregistered meanwhile
+		}
+		if h, ok := spider.(URLHandler); ok && h.HandlesURL(u) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,239 @@
+// Package spytest provides utilities to test spiders offline:
+// responses built from strings or files, a fetcher handler serving fixtures,
+// and a crawl runner collecting the items, requests and stats of a whole crawl.
+package spytest
+
+import (
+	"bytes"
+	"context"
+	"github.com/ridewindx/spy"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Fixture is the response served for a URL.
+type Fixture struct {
+	Status int // 200 by default
+	Header http.Header
+	Body   string
+	File   string // read at fetch time instead of Body, if set
+}
+
+// Fixtures are the fixtures by URL.
+type Fixtures map[string]*Fixture
+
+// HTML returns a fixture of the HTML document.
+func HTML(body string) *Fixture {
+	return &Fixture{Body: body, Header: http.Header{"Content-Type": {"text/html; charset=utf-8"}}}
+}
+
+// JSON returns a fixture of the JSON document.
+func JSON(body string) *Fixture {
+	return &Fixture{Body: body, Header: http.Header{"Content-Type": {spy.MIMEJSON}}}
+}
+
+// File returns a fixture of the file, whose media type is guessed from its extension, HTML by default.
+func File(filename string) *Fixture {
+	return &Fixture{File: filename}
+}
+
+// body returns the body and the header of the fixture, with a Content-Type.
+func (f *Fixture) body() ([]byte, http.Header, error) {
+	header := http.Header{}
+	for k, v := range f.Header {
+		header[k] = v
+	}
+
+	body := []byte(f.Body)
+	if f.File != "" {
+		var err error
+		if body, err = ioutil.ReadFile(f.File); err != nil {
+			return nil, nil, err
+		}
+		if header.Get("Content-Type") == "" {
+			header.Set("Content-Type", mime.TypeByExtension(filepath.Ext(f.File)))
+		}
+	}
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", "text/html; charset=utf-8")
+	}
+	return body, header, nil
+}
+
+// Response returns the response of the fixture for the request.
+func (f *Fixture) Response(request *spy.Request) (*spy.Response, error) {
+	body, header, err := f.body()
+	if err != nil {
+		return nil, err
+	}
+	status := f.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	hr := &http.Response{
+		Status:        strconv.Itoa(status) + " " + http.StatusText(status),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       request.Request,
+	}
+	response, err := spy.NewResponse(hr)
+	if err != nil {
+		return nil, err
+	}
+	response.Request = request
+	return response, nil
+}
+
+// NewResponse returns a response of the URL with the fixture, as received by a spider callback.
+// Like httptest.NewRequest, it panics on error, since it is meant for tests.
+func NewResponse(rawurl string, fixture *Fixture) *spy.Response {
+	request := spy.NewRequest(rawurl, http.MethodGet)
+	if request.Error != nil {
+		panic("spytest: invalid URL: " + request.Error.Error())
+	}
+	response, err := fixture.Response(request)
+	if err != nil {
+		panic("spytest: invalid fixture: " + err.Error())
+	}
+	return response
+}
+
+// HTMLResponse returns a response of the URL with the HTML document.
+func HTMLResponse(rawurl, body string) *spy.Response {
+	return NewResponse(rawurl, HTML(body))
+}
+
+// JSONResponse returns a response of the URL with the JSON document.
+func JSONResponse(rawurl, body string) *spy.Response {
+	return NewResponse(rawurl, JSON(body))
+}
+
+// FileResponse returns a response of the URL with the content of the file.
+func FileResponse(rawurl, filename string) *spy.Response {
+	return NewResponse(rawurl, File(filename))
+}
+
+// FakeFetcherHandler is a fetcher handler serving fixtures by URL, and 404 Not Found for other URLs.
+type FakeFetcherHandler struct {
+	Fixtures Fixtures
+
+	fetched []string
+	mutex   sync.Mutex
+}
+
+func NewFakeFetcherHandler(fixtures Fixtures) *FakeFetcherHandler {
+	return &FakeFetcherHandler{
+		Fixtures: fixtures,
+	}
+}
+
+func (h *FakeFetcherHandler) Fetch(request *spy.Request, spider spy.ISpider) (*spy.Response, error) {
+	u := request.URL.String()
+	h.mutex.Lock()
+	h.fetched = append(h.fetched, u)
+	h.mutex.Unlock()
+
+	fixture, ok := h.Fixtures[u]
+	if !ok {
+		fixture = &Fixture{Status: http.StatusNotFound}
+	}
+	return fixture.Response(request)
+}
+
+func (h *FakeFetcherHandler) Close() {
+
+}
+
+// Fetched returns the URLs fetched, in order.
+func (h *FakeFetcherHandler) Fetched() []string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return append([]string(nil), h.fetched...)
+}
+
+// CrawlResult is what a crawl produced.
+type CrawlResult struct {
+	Items    []interface{}          // scraped, i.e., not dropped by the pipelines
+	Requests []*spy.Request         // scheduled, including the start requests, but not the duplicates
+	Fetched  []string               // the URLs fetched, in order
+	Stats    map[string]interface{} // the stats once the spider closed
+}
+
+// Timeout bounds RunCrawl, so that a spider which never goes idle fails the test.
+var Timeout = time.Minute
+
+// RunCrawl crawls with the spider, fetching the fixtures instead of the network,
+// until the spider is idle. The crawler is a spy.NewDefaultCrawler without logging;
+// setup functions can customize it, e.g., to register pipelines.
+func RunCrawl(spider spy.ISpider, fixtures Fixtures, setup ...func(crawler *spy.Crawler)) (*CrawlResult, error) {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	crawler := spy.NewDefaultCrawler(spider, nil)
+	crawler.Logger = logger
+	crawler.HandleSignals = false
+
+	handler := NewFakeFetcherHandler(fixtures)
+	fetcher := spy.NewFetcher()
+	fetcher.RegisterHandler("http", handler)
+	fetcher.RegisterHandler("https", handler)
+	crawler.Fetcher = fetcher
+
+	for _, fn := range setup {
+		fn(crawler)
+	}
+
+	result := &CrawlResult{}
+	var mutex sync.Mutex
+	crawler.Events.OnItemScraped(func(spider spy.ISpider, response *spy.Response, item interface{}) error {
+		mutex.Lock()
+		result.Items = append(result.Items, item)
+		mutex.Unlock()
+		return nil
+	})
+	crawler.Events.OnRequestScheduled(func(spider spy.ISpider, request *spy.Request) error {
+		mutex.Lock()
+		result.Requests = append(result.Requests, request)
+		mutex.Unlock()
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	err := crawler.Run(ctx)
+	crawler.Fetcher.Close(spider) // stops the goroutines of the slots
+
+	result.Fetched = handler.Fetched()
+	result.Stats = crawler.Stats.GetAll()
+	return result, err
+}
+
+// ReplayCrawl crawls with the spider like RunCrawl, replaying the cassette recorded
+// with spy.NewCassetteRecorder instead of the fixtures. Requests not in the cassette fail,
+// and Fetched of the result is empty.
+func ReplayCrawl(spider spy.ISpider, cassette string, setup ...func(crawler *spy.Crawler)) (*CrawlResult, error) {
+	player, err := spy.NewCassettePlayer(cassette)
+	if err != nil {
+		return nil, err
+	}
+
+	replay := func(crawler *spy.Crawler) {
+		fetcher := crawler.Fetcher.(*spy.Fetcher)
+		fetcher.RegisterHandler("http", player)
+		fetcher.RegisterHandler("https", player)
+	}
+	return RunCrawl(spider, nil, append([]func(*spy.Crawler){replay}, setup...)...)
+}
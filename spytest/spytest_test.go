@@ -0,0 +1,250 @@
+package spytest
+
+import (
+	"context"
+	"errors"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/ridewindx/spy"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// shopSpider follows the links of the pages from its start URL, and scrapes the titles of product pages.
+type shopSpider struct {
+	crawler *spy.Crawler
+}
+
+func (s *shopSpider) StartRequests() []*spy.Request {
+	return []*spy.Request{spy.NewRequest("http://shop.test/", http.MethodGet)}
+}
+
+func (s *shopSpider) Parse(response *spy.Response) (*spy.SpiderResult, error) {
+	result := &spy.SpiderResult{}
+	if response.StatusCode != http.StatusOK {
+		return result, nil
+	}
+	response.HTMLDoc.Find("a[href]").Each(func(i int, a *goquery.Selection) {
+		href, _ := a.Attr("href")
+		u, err := response.Request.URL.Parse(href)
+		if err == nil {
+			result.Requests = append(result.Requests, spy.NewRequest(u.String(), http.MethodGet))
+		}
+	})
+	if title := response.HTMLDoc.Find("h1.product").Text(); title != "" {
+		result.Items = append(result.Items, &spy.Item{"title": title})
+	}
+	return result, nil
+}
+
+func (s *shopSpider) FetchDelay() time.Duration {
+	return 0
+}
+
+func (s *shopSpider) ConcurrentRequests() int {
+	return 0
+}
+
+func (s *shopSpider) String() string {
+	return "shop"
+}
+
+func (s *shopSpider) Crawler() *spy.Crawler {
+	return s.crawler
+}
+
+func (s *shopSpider) SetCrawler(crawler *spy.Crawler) {
+	s.crawler = crawler
+}
+
+var shopFixtures = Fixtures{
+	"http://shop.test/":           HTML(`<a href="/products/1">Pen</a>`),
+	"http://shop.test/products/1": HTML(`<h1 class="product">Pen</h1><a href="/products/2">Ink</a>`),
+	// /products/2 is unknown, so 404 Not Found
+}
+
+func TestRunCrawl(t *testing.T) {
+	result, err := RunCrawl(&shopSpider{}, shopFixtures)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantFetched := []string{"http://shop.test/", "http://shop.test/products/1", "http://shop.test/products/2"}
+	if !reflect.DeepEqual(result.Fetched, wantFetched) {
+		t.Errorf("Fetched = %q, want %q", result.Fetched, wantFetched)
+	}
+
+	var requested []string
+	for _, request := range result.Requests {
+		requested = append(requested, request.URL.String())
+	}
+	if !reflect.DeepEqual(requested, wantFetched) {
+		t.Errorf("Requests = %q, want %q", requested, wantFetched)
+	}
+
+	wantItems := []interface{}{&spy.Item{"title": "Pen"}}
+	if !reflect.DeepEqual(result.Items, wantItems) {
+		t.Errorf("Items = %v, want %v", result.Items, wantItems)
+	}
+
+	if reason := result.Stats["finish_reason"]; reason != spy.FinishReasonFinished {
+		t.Errorf("finish_reason = %v, want %s", reason, spy.FinishReasonFinished)
+	}
+}
+
+func TestRunCrawlNotFound(t *testing.T) {
+	result, err := RunCrawl(&shopSpider{}, Fixtures{
+		"http://shop.test/": HTML(`<a href="/missing">Gone</a>`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := result.Stats["response_status_count/404"]; n != int64(1) {
+		t.Errorf("response_status_count/404 = %v, want 1", n)
+	}
+	if len(result.Items) != 0 {
+		t.Errorf("Items = %v, want none", result.Items)
+	}
+}
+
+func TestRunCrawlTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { Timeout = timeout }(Timeout)
+	Timeout = 200 * time.Millisecond
+
+	// a spider kept open never goes idle
+	keepOpen := func(crawler *spy.Crawler) {
+		crawler.Events.OnSpiderIdle(func(spider spy.ISpider) error {
+			return spy.ErrDontCloseSpider
+		})
+	}
+
+	start := time.Now()
+	_, err := RunCrawl(&shopSpider{}, shopFixtures, keepOpen)
+	var crawlErr *spy.CrawlError
+	if !errors.As(err, &crawlErr) || crawlErr.Reason != spy.FinishReasonCanceled {
+		t.Fatalf("err = %v, want a canceled crawl", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("RunCrawl returned after %s", elapsed)
+	}
+}
+
+// sloppySpider yields an invalid request from the start page, and no result from the other pages.
+type sloppySpider struct {
+	shopSpider
+}
+
+func (s *sloppySpider) Parse(response *spy.Response) (*spy.SpiderResult, error) {
+	if response.Request.URL.Path != "/" {
+		return nil, nil
+	}
+	result, err := s.shopSpider.Parse(response)
+	if result != nil {
+		result.Requests = append(result.Requests, spy.NewRequest("http://shop.test/%zz", http.MethodGet))
+	}
+	return result, err
+}
+
+func TestRunCrawlSloppySpider(t *testing.T) {
+	result, err := RunCrawl(&sloppySpider{}, shopFixtures)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantFetched := []string{"http://shop.test/", "http://shop.test/products/1"}
+	if !reflect.DeepEqual(result.Fetched, wantFetched) {
+		t.Errorf("Fetched = %q, want %q", result.Fetched, wantFetched)
+	}
+	if n := result.Stats["request_dropped_count"]; n != int64(1) {
+		t.Errorf("request_dropped_count = %v, want 1 for the invalid request", n)
+	}
+	if reason := result.Stats["finish_reason"]; reason != spy.FinishReasonFinished {
+		t.Errorf("finish_reason = %v, want %s", reason, spy.FinishReasonFinished)
+	}
+}
+
+// slowHandler delays the fetches of a URL, signaling when one starts.
+type slowHandler struct {
+	spy.FetcherHandler
+	url     string
+	started chan struct{}
+	delay   time.Duration
+}
+
+func (h *slowHandler) Fetch(request *spy.Request, spider spy.ISpider) (*spy.Response, error) {
+	if request.URL.String() == h.url {
+		close(h.started)
+		time.Sleep(h.delay)
+	}
+	return h.FetcherHandler.Fetch(request, spider)
+}
+
+func TestRunCrawlStopScrapesFetchInFlight(t *testing.T) {
+	slow := func(crawler *spy.Crawler) {
+		handler := &slowHandler{
+			FetcherHandler: NewFakeFetcherHandler(shopFixtures),
+			url:            "http://shop.test/products/1",
+			started:        make(chan struct{}),
+			delay:          200 * time.Millisecond,
+		}
+		fetcher := crawler.Fetcher.(*spy.Fetcher)
+		fetcher.RegisterHandler("http", handler)
+		go func() {
+			<-handler.started
+			crawler.Stop()
+		}()
+	}
+
+	result, err := RunCrawl(&shopSpider{}, nil, slow)
+	var crawlErr *spy.CrawlError
+	if !errors.As(err, &crawlErr) || crawlErr.Reason != spy.FinishReasonShutdown {
+		t.Fatalf("err = %v, want a shut down crawl", err)
+	}
+
+	wantItems := []interface{}{&spy.Item{"title": "Pen"}}
+	if !reflect.DeepEqual(result.Items, wantItems) {
+		t.Errorf("Items = %v, want %v scraped from the fetch in flight", result.Items, wantItems)
+	}
+}
+
+func TestReplayCrawlRecordedCassette(t *testing.T) {
+	cassette := filepath.Join(t.TempDir(), "shop.jsonl")
+	record := func(crawler *spy.Crawler) {
+		recorder, err := spy.NewCassetteRecorder(cassette, NewFakeFetcherHandler(shopFixtures))
+		if err != nil {
+			t.Fatal(err)
+		}
+		crawler.Fetcher.(*spy.Fetcher).RegisterHandler("http", recorder)
+	}
+	recorded, err := RunCrawl(&shopSpider{}, nil, record)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replayed, err := ReplayCrawl(&shopSpider{}, cassette)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(replayed.Items, recorded.Items) || len(replayed.Items) != 1 {
+		t.Errorf("replayed Items = %v, want %v", replayed.Items, recorded.Items)
+	}
+	for _, key := range []string{"response_status_count/200", "response_status_count/404", "response_bytes", "spider_error_count"} {
+		if replayed.Stats[key] != recorded.Stats[key] {
+			t.Errorf("replayed %s = %v, want %v", key, replayed.Stats[key], recorded.Stats[key])
+		}
+	}
+
+	// the recording of a request doesn't replay for another host
+	player, err := spy.NewCassettePlayer(cassette)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = player.Fetch(spy.NewRequest("http://other.test/", http.MethodGet), &shopSpider{}); !errors.Is(err, spy.ErrNotInCassette) {
+		t.Errorf("err = %v for another host, want ErrNotInCassette", err)
+	}
+}
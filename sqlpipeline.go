@@ -0,0 +1,289 @@
+package spy
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SQLDialect selects the SQL syntax differences between databases.
+type SQLDialect int
+
+const (
+	SQLite SQLDialect = iota
+	PostgreSQL
+	MySQL
+)
+
+func (d SQLDialect) placeholder(i int) string {
+	if d == PostgreSQL {
+		return "$" + strconv.Itoa(i+1)
+	}
+	return "?"
+}
+
+func (d SQLDialect) quote(ident string) string {
+	if d == MySQL {
+		return "`" + strings.Replace(ident, "`", "``", -1) + "`"
+	}
+	return `"` + strings.Replace(ident, `"`, `""`, -1) + `"`
+}
+
+// columnType returns the column type of a Go value, for a key column or not.
+func (d SQLDialect) columnType(value interface{}, key bool) string {
+	switch value.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return "BIGINT"
+	case float32, float64:
+		if d == SQLite {
+			return "REAL"
+		}
+		return "DOUBLE PRECISION"
+	case bool:
+		return "BOOLEAN"
+	case time.Time, *time.Time:
+		if d == MySQL {
+			return "DATETIME"
+		}
+		return "TIMESTAMP"
+	case []byte:
+		if d == PostgreSQL {
+			return "BYTEA"
+		}
+		return "BLOB"
+	default:
+		if d == MySQL && key {
+			return "VARCHAR(255)" // keys can't be TEXT
+		}
+		return "TEXT"
+	}
+}
+
+func (d SQLDialect) upsert(key []string, columns []string) string {
+	var sets []string
+	for _, column := range columns {
+		if d == MySQL {
+			sets = append(sets, fmt.Sprintf("%s = VALUES(%s)", d.quote(column), d.quote(column)))
+		} else {
+			sets = append(sets, fmt.Sprintf("%s = excluded.%s", d.quote(column), d.quote(column)))
+		}
+	}
+
+	if d == MySQL {
+		return " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+	}
+	quoted := make([]string, len(key))
+	for i, k := range key {
+		quoted[i] = d.quote(k)
+	}
+	if len(sets) == 0 {
+		return fmt.Sprintf(" ON CONFLICT (%s) DO NOTHING", strings.Join(quoted, ", "))
+	}
+	return fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s", strings.Join(quoted, ", "), strings.Join(sets, ", "))
+}
+
+// SQLPipeline writes items into a database table.
+// It is a BatchItemProcessor: each batch is inserted in a transaction,
+// and the last partial batch is flushed by the ItemPipelineManager when the spider closes.
+//
+// The table is created if missing, with columns typed after the values of the first batch.
+// Slice, map and struct values other than time.Time are stored as JSON.
+type SQLPipeline struct {
+	DB      *sql.DB
+	Dialect SQLDialect
+	Table   string
+
+	// Columns maps item fields to table columns. Fields not mapped are not stored.
+	// Defaults to the fields of the first batch, mapped to columns of the same names.
+	Columns map[string]string
+
+	// Key lists the fields of the unique key of the table.
+	// If set, items are upserted: an item with the key of an existing row updates it.
+	Key []string
+
+	fields []string // in column order
+	insert string
+	mutex  sync.Mutex
+}
+
+func NewSQLPipeline(db *sql.DB, dialect SQLDialect, table string) *SQLPipeline {
+	return &SQLPipeline{
+		DB:      db,
+		Dialect: dialect,
+		Table:   table,
+	}
+}
+
+func (sp *SQLPipeline) ProcessItems(items []interface{}, spider ISpider) ([]interface{}, error) {
+	rows := make([]map[string]interface{}, len(items))
+	for i, item := range items {
+		adapter, err := NewItemAdapter(item)
+		if err != nil {
+			return nil, err
+		}
+		rows[i] = itemAsMap(adapter)
+	}
+
+	insert, err := sp.prepareTable(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := spiderContext(spider)
+	tx, err := sp.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	stmt, err := tx.PrepareContext(ctx, insert)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	defer stmt.Close()
+
+	for _, row := range rows {
+		args := make([]interface{}, len(sp.fields))
+		for i, field := range sp.fields {
+			args[i], err = sqlValue(row[field])
+			if err != nil {
+				tx.Rollback()
+				return nil, fmt.Errorf("field %s: %s", field, err)
+			}
+		}
+		if _, err = stmt.ExecContext(ctx, args...); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	spider.Crawler().Stats.Inc("sql/batches")
+	return items, nil
+}
+
+// prepareTable creates the table on the first batch, and returns the insert statement.
+func (sp *SQLPipeline) prepareTable(rows []map[string]interface{}) (string, error) {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+
+	if sp.insert != "" {
+		return sp.insert, nil
+	}
+
+	// the mapping is only kept once the table exists, so that a failed batch can be retried
+	mapping := sp.Columns
+	if len(mapping) == 0 {
+		mapping = make(map[string]string)
+		for _, row := range rows {
+			for field := range row {
+				mapping[field] = field
+			}
+		}
+	}
+	var fields []string
+	for field := range mapping {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	d := sp.Dialect
+	var defs, columns, placeholders, updates, keys []string
+	for i, field := range fields {
+		column := mapping[field]
+
+		var sample interface{}
+		for _, row := range rows {
+			if v, ok := row[field]; ok && v != nil {
+				sample = v
+				break
+			}
+		}
+
+		isKey := false
+		for _, k := range sp.Key {
+			isKey = isKey || k == field
+		}
+		defs = append(defs, d.quote(column)+" "+d.columnType(sample, isKey))
+		columns = append(columns, d.quote(column))
+		placeholders = append(placeholders, d.placeholder(i))
+		if !isKey {
+			updates = append(updates, column)
+		}
+	}
+	for _, k := range sp.Key {
+		column, ok := mapping[k]
+		if !ok {
+			return "", fmt.Errorf("key field %s is not mapped to a column", k)
+		}
+		keys = append(keys, column)
+	}
+
+	create := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s", d.quote(sp.Table), strings.Join(defs, ", "))
+	if len(keys) > 0 {
+		quoted := make([]string, len(keys))
+		for i, k := range keys {
+			quoted[i] = d.quote(k)
+		}
+		create += fmt.Sprintf(", PRIMARY KEY (%s)", strings.Join(quoted, ", "))
+	}
+	create += ")"
+	if _, err := sp.DB.Exec(create); err != nil {
+		return "", err
+	}
+
+	insert := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		d.quote(sp.Table), strings.Join(columns, ", "), strings.Join(placeholders, ", "))
+	if len(keys) > 0 {
+		insert += d.upsert(keys, updates)
+	}
+	sp.Columns = mapping
+	sp.fields = fields
+	sp.insert = insert
+	return insert, nil
+}
+
+// sqlValue converts an item value to a database/sql argument.
+func sqlValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil, string, []byte, bool, int64, float64, time.Time:
+		return v, nil
+	case *time.Time:
+		if v == nil {
+			return nil, nil
+		}
+		return *v, nil
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return nil, nil
+		}
+		return sqlValue(rv.Elem().Interface())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Bool:
+		return rv.Bool(), nil
+	default: // slices, maps, structs
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		return string(data), nil
+	}
+}
@@ -0,0 +1,91 @@
+package spy
+
+import (
+	"database/sql"
+	_ "github.com/mattn/go-sqlite3"
+	"strings"
+	"testing"
+)
+
+func openSQLite(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1) // every connection has its own in-memory database
+	return db
+}
+
+func TestSQLPipelineUpsert(t *testing.T) {
+	db := openSQLite(t)
+	defer db.Close()
+	spider := newTestSpider("sql")
+
+	sp := NewSQLPipeline(db, SQLite, "products")
+	sp.Key = []string{"id"}
+
+	batches := [][]interface{}{
+		{&Item{"id": 1, "name": "pen", "tags": []string{"office"}}, &Item{"id": 2, "name": "ink"}},
+		{&Item{"id": 1, "name": "fountain pen", "tags": []string{"office", "gift"}}},
+	}
+	for _, batch := range batches {
+		if _, err := sp.ProcessItems(batch, spider); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rows, err := db.Query(`SELECT "id", "name", "tags" FROM "products" ORDER BY "id"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var got []string
+	for rows.Next() {
+		var id int64
+		var name string
+		var tags sql.NullString
+		if err = rows.Scan(&id, &name, &tags); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, name+" "+tags.String)
+	}
+	want := []string{`fountain pen ["office","gift"]`, "ink "}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("rows = %q, want %q", got, want)
+	}
+	if n := spider.crawler.Stats.GetInt("sql/batches"); n != 2 {
+		t.Errorf("sql/batches = %d, want 2", n)
+	}
+}
+
+func TestSQLPipelineRetriesFailedCreate(t *testing.T) {
+	closed := openSQLite(t)
+	closed.Close()
+	db := openSQLite(t)
+	defer db.Close()
+	spider := newTestSpider("sql")
+
+	sp := NewSQLPipeline(closed, SQLite, "products")
+	batch := []interface{}{&Item{"id": 1, "name": "pen"}}
+	if _, err := sp.ProcessItems(batch, spider); err == nil {
+		t.Fatal("expected an error on a closed database")
+	}
+
+	sp.DB = db
+	if _, err := sp.ProcessItems(batch, spider); err != nil {
+		t.Fatal(err)
+	}
+	if len(sp.fields) != 2 {
+		t.Errorf("fields = %q, want 2 fields", sp.fields)
+	}
+}
+
+func TestSQLDialectColumnType(t *testing.T) {
+	if typ := MySQL.columnType("long text", false); typ != "TEXT" {
+		t.Errorf("MySQL string column = %s, want TEXT", typ)
+	}
+	if typ := MySQL.columnType("key", true); typ != "VARCHAR(255)" {
+		t.Errorf("MySQL string key column = %s, want VARCHAR(255)", typ)
+	}
+}
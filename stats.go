@@ -1,16 +1,70 @@
 package spy
 
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StatsCollector collects stats as key/value pairs.
+// Values are int64, float64, string or time.Time.
+// All methods are safe for concurrent use.
+type StatsCollector interface {
+	Opener
+	Closer
+
+	Get(key string) (value interface{}, ok bool)
+	GetInt(key string) int64
+	GetFloat(key string) float64
+	GetString(key string) string
+	GetTime(key string) time.Time
+
+	// GetAll returns a snapshot of all the stats.
+	GetAll() map[string]interface{}
+
+	// Set sets the value, converting integers to int64, floats to float64,
+	// and durations to float64 seconds.
+	Set(key string, value interface{})
+
+	// Inc increments an integer value by 1, or by the given amount. A missing value counts as 0.
+	Inc(key string, by ...int64)
+
+	// IncFloat increments a float value by the given amount. A missing value counts as 0.
+	IncFloat(key string, by float64)
+
+	// Max sets the value if it is greater than the current value, or if there is no comparable value.
+	Max(key string, value interface{})
+
+	// Min sets the value if it is less than the current value, or if there is no comparable value.
+	Min(key string, value interface{})
+
+	Del(key string)
+	Clear()
+
+	// Namespace returns a collector whose keys are prefixed with the name and a slash,
+	// e.g., one per spider, sharing the stats of this collector.
+	Namespace(name string) StatsCollector
+}
+
+type statsStore struct {
+	mutex  sync.RWMutex
+	values map[string]interface{}
+}
+
+// Stats is the default StatsCollector, keeping stats in memory.
 type Stats struct {
-	Name          string
-	uint64Buckets map[string]uint64
-	stringBuckets map[string]string
+	Name   string
+	prefix string
+	store  *statsStore
 }
 
 func NewStats(name string) *Stats {
 	return &Stats{
-		Name:          name,
-		uint64Buckets: make(map[string]uint64),
-		stringBuckets: make(map[string]string),
+		Name: name,
+		store: &statsStore{
+			values: make(map[string]interface{}),
+		},
 	}
 }
 
@@ -22,61 +76,235 @@ func (stats *Stats) Close(spider ISpider) {
 
 }
 
-func (stats *Stats) Get(key string) uint64 {
-	if v, ok := stats.stringBuckets[key]; ok {
+func (stats *Stats) Namespace(name string) StatsCollector {
+	return &Stats{
+		Name:   name,
+		prefix: stats.prefix + name + "/",
+		store:  stats.store,
+	}
+}
+
+func (stats *Stats) Get(key string) (interface{}, bool) {
+	stats.store.mutex.RLock()
+	defer stats.store.mutex.RUnlock()
+	v, ok := stats.store.values[stats.prefix+key]
+	return v, ok
+}
+
+func (stats *Stats) GetInt(key string) int64 {
+	switch v, _ := stats.Get(key); v := v.(type) {
+	case int64:
 		return v
-	} else {
+	case float64:
+		return int64(v)
+	default:
 		return 0
 	}
 }
 
-func (stats *Stats) Inc(key string) {
-	if _, ok := stats.uint64Buckets[key]; ok {
-		stats.uint64Buckets[key] += 1
-	} else {
-		stats.uint64Buckets[key] = 0
+func (stats *Stats) GetFloat(key string) float64 {
+	switch v, _ := stats.Get(key); v := v.(type) {
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	default:
+		return 0
 	}
-	return
 }
 
-func (stats *Stats) Max(key string, value uint64) {
-	if v, ok := stats.uint64Buckets[key]; ok {
-		if value > v {
-			stats.uint64Buckets[key] = value
-		}
-	} else {
-		stats.uint64Buckets[key] = value
+func (stats *Stats) GetString(key string) string {
+	switch v, _ := stats.Get(key); v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
 	}
 }
 
-func (stats *Stats) Min(key string, value uint64) {
-	if v, ok := stats.uint64Buckets[key]; ok {
-		if value < v {
-			stats.uint64Buckets[key] = value
+func (stats *Stats) GetTime(key string) time.Time {
+	v, _ := stats.Get(key)
+	t, _ := v.(time.Time)
+	return t
+}
+
+func (stats *Stats) GetAll() map[string]interface{} {
+	stats.store.mutex.RLock()
+	defer stats.store.mutex.RUnlock()
+	all := make(map[string]interface{})
+	for k, v := range stats.store.values {
+		if strings.HasPrefix(k, stats.prefix) {
+			all[k[len(stats.prefix):]] = v
 		}
-	} else {
-		stats.uint64Buckets[key] = value
 	}
+	return all
 }
 
-func (stats *Stats) SetStr(key, value string) {
-	stats.stringBuckets[key] = value
+func (stats *Stats) Set(key string, value interface{}) {
+	value = normalizeStat(value)
+	stats.store.mutex.Lock()
+	stats.store.values[stats.prefix+key] = value
+	stats.store.mutex.Unlock()
 }
 
-func (stats *Stats) GetStr(key string) string {
-	if v, ok := stats.stringBuckets[key]; ok {
-		return v
-	} else {
-		return ""
+func (stats *Stats) Inc(key string, by ...int64) {
+	var n int64 = 1
+	if len(by) > 0 {
+		n = by[0]
+	}
+
+	stats.store.mutex.Lock()
+	defer stats.store.mutex.Unlock()
+	key = stats.prefix + key
+	switch v := stats.store.values[key].(type) {
+	case int64:
+		stats.store.values[key] = v + n
+	case float64:
+		stats.store.values[key] = v + float64(n)
+	default:
+		stats.store.values[key] = n
+	}
+}
+
+func (stats *Stats) IncFloat(key string, by float64) {
+	stats.store.mutex.Lock()
+	defer stats.store.mutex.Unlock()
+	key = stats.prefix + key
+	switch v := stats.store.values[key].(type) {
+	case int64:
+		stats.store.values[key] = float64(v) + by
+	case float64:
+		stats.store.values[key] = v + by
+	default:
+		stats.store.values[key] = by
+	}
+}
+
+func (stats *Stats) Max(key string, value interface{}) {
+	stats.update(key, value, func(c int) bool { return c > 0 })
+}
+
+func (stats *Stats) Min(key string, value interface{}) {
+	stats.update(key, value, func(c int) bool { return c < 0 })
+}
+
+// update sets the value if there is no comparable current value,
+// or if accept returns true for the comparison of the value with the current value.
+func (stats *Stats) update(key string, value interface{}, accept func(c int) bool) {
+	value = normalizeStat(value)
+	stats.store.mutex.Lock()
+	defer stats.store.mutex.Unlock()
+	key = stats.prefix + key
+	if c, ok := compareStats(value, stats.store.values[key]); !ok || accept(c) {
+		stats.store.values[key] = value
 	}
 }
 
 func (stats *Stats) Del(key string) {
-	delete(stats.uint64Buckets[key], key)
-	delete(stats.stringBuckets[key], key)
+	stats.store.mutex.Lock()
+	delete(stats.store.values, stats.prefix+key)
+	stats.store.mutex.Unlock()
 }
 
+// Clear deletes all the stats of the namespace.
 func (stats *Stats) Clear() {
-	stats.uint64Buckets = make(map[string]uint64)
-	stats.stringBuckets = make(map[string]string)
+	stats.store.mutex.Lock()
+	defer stats.store.mutex.Unlock()
+	for k := range stats.store.values {
+		if strings.HasPrefix(k, stats.prefix) {
+			delete(stats.store.values, k)
+		}
+	}
+}
+
+func normalizeStat(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case uint:
+		return int64(v)
+	case uint8:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case uint64:
+		return int64(v)
+	case float32:
+		return float64(v)
+	case time.Duration:
+		return v.Seconds()
+	case int64, float64, string, time.Time:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// compareStats returns -1, 0 or 1 as a is less than, equal to or greater than b,
+// and false if they are not comparable.
+func compareStats(a, b interface{}) (int, bool) {
+	switch a := a.(type) {
+	case int64:
+		switch b := b.(type) {
+		case int64:
+			return compareInts(a, b), true
+		case float64:
+			return compareFloats(float64(a), b), true
+		}
+	case float64:
+		switch b := b.(type) {
+		case int64:
+			return compareFloats(a, float64(b)), true
+		case float64:
+			return compareFloats(a, b), true
+		}
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b), true
+		}
+	case time.Time:
+		if b, ok := b.(time.Time); ok {
+			switch {
+			case a.Before(b):
+				return -1, true
+			case a.After(b):
+				return 1, true
+			default:
+				return 0, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareInts(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
 }
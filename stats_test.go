@@ -0,0 +1,81 @@
+package spy
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStatsConcurrent(t *testing.T) {
+	stats := newTestSpider("stats").crawler.Stats
+	spiderStats := stats.Namespace("stats")
+
+	const goroutines, times = 8, 1000
+	var waitGroup sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		waitGroup.Add(1)
+		go func(g int) {
+			defer waitGroup.Done()
+			for i := 0; i < times; i++ {
+				stats.Inc("count")
+				spiderStats.Inc("count", 2)
+				spiderStats.IncFloat("seconds", 0.5)
+				stats.Max("max", g*times+i)
+				stats.Min("min", g*times+i)
+				stats.Set("last", i)
+				stats.GetInt("count")
+				spiderStats.GetAll()
+			}
+		}(g)
+	}
+	waitGroup.Wait()
+
+	if n := stats.GetInt("count"); n != goroutines*times {
+		t.Errorf("count = %d, want %d", n, goroutines*times)
+	}
+	if n := spiderStats.GetInt("count"); n != 2*goroutines*times {
+		t.Errorf("stats/count = %d, want %d", n, 2*goroutines*times)
+	}
+	if f := stats.GetFloat("stats/seconds"); f != 0.5*goroutines*times {
+		t.Errorf("stats/seconds = %v, want %v", f, 0.5*goroutines*times)
+	}
+	if n := stats.GetInt("max"); n != goroutines*times-1 {
+		t.Errorf("max = %d, want %d", n, goroutines*times-1)
+	}
+	if n := stats.GetInt("min"); n != 0 {
+		t.Errorf("min = %d, want 0", n)
+	}
+	if n := stats.GetInt("last"); n != times-1 {
+		t.Errorf("last = %d, want %d", n, times-1)
+	}
+}
+
+func TestStatsNamespace(t *testing.T) {
+	stats := NewStats("crawler")
+	spiderStats := stats.Namespace("spider")
+
+	start := time.Date(2020, 3, 4, 5, 6, 7, 0, time.UTC)
+	stats.Set("start_time", start)
+	spiderStats.Set("elapsed", 1500*time.Millisecond)
+	spiderStats.Set("status", "ok")
+	spiderStats.Min("depth", 3)
+	spiderStats.Min("depth", int32(2))
+	spiderStats.Max("depth", "deep") // not comparable, replaces the value
+
+	want := map[string]interface{}{"elapsed": 1.5, "status": "ok", "depth": "deep"}
+	if all := spiderStats.GetAll(); !reflect.DeepEqual(all, want) {
+		t.Errorf("GetAll() = %v, want %v", all, want)
+	}
+	if got := stats.GetTime("start_time"); !got.Equal(start) {
+		t.Errorf("start_time = %v, want %v", got, start)
+	}
+	if got := stats.GetString("spider/elapsed"); got != "1.5" {
+		t.Errorf("spider/elapsed = %q, want the namespaced stat", got)
+	}
+
+	spiderStats.Clear()
+	if _, ok := stats.Get("start_time"); !ok || len(spiderStats.GetAll()) != 0 {
+		t.Errorf("Clear() of the namespace left %v, and the parent %v", spiderStats.GetAll(), stats.GetAll())
+	}
+}
@@ -0,0 +1,273 @@
+package spy
+
+import (
+	"fmt"
+	"github.com/xeipuuv/gojsonschema"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ItemSchema validates the fields of items.
+type ItemSchema interface {
+	Validate(item ItemAdapter) []FieldError
+}
+
+// ValidationPipeline drops the items which don't validate against its schema,
+// with an *ItemDroppedError listing the invalid fields.
+type ValidationPipeline struct {
+	Schema ItemSchema
+}
+
+func NewValidationPipeline(schema ItemSchema) *ValidationPipeline {
+	return &ValidationPipeline{
+		Schema: schema,
+	}
+}
+
+func (vp *ValidationPipeline) ProcessItem(item interface{}, spider ISpider) (interface{}, error) {
+	adapter, err := NewItemAdapter(item)
+	if err != nil {
+		return nil, err
+	}
+
+	fieldErrors := vp.Schema.Validate(adapter)
+	if len(fieldErrors) == 0 {
+		return item, nil
+	}
+
+	stats := spider.Crawler().Stats
+	stats.Inc("validation/dropped")
+	for _, fe := range fieldErrors {
+		stats.Inc("validation/invalid/" + fe.Field)
+	}
+	return nil, &ItemDroppedError{
+		Reason: "invalid item",
+		Fields: fieldErrors,
+	}
+}
+
+type jsonItemSchema struct {
+	schema *gojsonschema.Schema
+}
+
+// NewJSONItemSchema compiles a JSON Schema document, which items are validated against
+// as JSON objects of their fields.
+func NewJSONItemSchema(doc string) (ItemSchema, error) {
+	schema, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(doc))
+	if err != nil {
+		return nil, err
+	}
+	return &jsonItemSchema{schema}, nil
+}
+
+func (s *jsonItemSchema) Validate(item ItemAdapter) []FieldError {
+	result, err := s.schema.Validate(gojsonschema.NewGoLoader(itemAsMap(item)))
+	if err != nil {
+		return []FieldError{{Field: "(root)", Rule: "json", Message: err.Error()}}
+	}
+
+	var fieldErrors []FieldError
+	for _, re := range result.Errors() {
+		field := re.Field()
+		if property, ok := re.Details()["property"].(string); ok && re.Type() == "required" {
+			field = property // required errors are reported on the parent
+		}
+		fieldErrors = append(fieldErrors, FieldError{
+			Field:   field,
+			Rule:    re.Type(),
+			Message: re.Description(),
+		})
+	}
+	return fieldErrors
+}
+
+type fieldRule struct {
+	field    string
+	typ      reflect.Type
+	required bool
+	min, max *float64
+	pattern  *regexp.Regexp
+}
+
+type structItemSchema struct {
+	rules  []*fieldRule
+	fields map[string]*fieldRule
+}
+
+// NewStructItemSchema builds a schema from the spy tags of a struct item type.
+// Besides the field name, a spy tag accepts the options:
+//
+//	required  the field must be set, and not the zero value of its type, e.g., "" or 0
+//	min=N     the minimum of a number, or the minimum length of a string, slice or map
+//	max=N     the maximum of a number, or the maximum length of a string, slice or map
+//
+// and a regular expression can be given in a separate pattern tag, which string values must match.
+// Missing fields, see the required option, are only checked if required.
+// For example:
+//
+//	type Product struct {
+//		SKU   string  `spy:"sku,required" pattern:"^[A-Z0-9-]+$"`
+//		Price float64 `spy:"price,required,min=0"`
+//	}
+//
+// Items of other types are validated against the field types: their values must be assignable
+// to the fields, and they must not have undeclared fields.
+func NewStructItemSchema(prototype interface{}) (ItemSchema, error) {
+	t := reflect.TypeOf(prototype)
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("unsupported item type %T, must be a struct", prototype)
+	}
+
+	schema := &structItemSchema{fields: make(map[string]*fieldRule)}
+	for _, sf := range reflect.VisibleFields(t) {
+		tag, ok := sf.Tag.Lookup("spy")
+		if !ok {
+			continue
+		}
+		options := strings.Split(tag, ",")
+		rule := &fieldRule{
+			field: strings.TrimSpace(options[0]),
+			typ:   sf.Type,
+		}
+		if rule.field == "-" {
+			continue
+		}
+
+		for _, option := range options[1:] {
+			option = strings.TrimSpace(option)
+			var err error
+			switch {
+			case option == "required":
+				rule.required = true
+			case strings.HasPrefix(option, "min="):
+				rule.min, err = parseBound(option[len("min="):])
+			case strings.HasPrefix(option, "max="):
+				rule.max, err = parseBound(option[len("max="):])
+			default:
+				err = fmt.Errorf("unknown option %q", option)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("item type %s, field %s: %s", t, sf.Name, err)
+			}
+		}
+
+		if pattern, ok := sf.Tag.Lookup("pattern"); ok {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("item type %s, field %s: %s", t, sf.Name, err)
+			}
+			rule.pattern = re
+		}
+
+		schema.rules = append(schema.rules, rule)
+		schema.fields[rule.field] = rule
+	}
+
+	if _, err := ItemFields(t); err != nil { // same checks as the item adapter
+		return nil, err
+	}
+	return schema, nil
+}
+
+func parseBound(s string) (*float64, error) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func (s *structItemSchema) Validate(item ItemAdapter) []FieldError {
+	var fieldErrors []FieldError
+
+	for _, field := range item.Fields() {
+		if _, ok := s.fields[field]; !ok {
+			fieldErrors = append(fieldErrors, FieldError{field, "unknown", "undeclared field"})
+		}
+	}
+
+	for _, rule := range s.rules {
+		if fieldMissing(item, rule.field) {
+			if rule.required {
+				fieldErrors = append(fieldErrors, FieldError{rule.field, "required", "missing value"})
+			}
+			continue
+		}
+
+		value, _ := item.Get(rule.field)
+		v := reflect.New(rule.typ).Elem()
+		if err := assignValue(v, reflect.ValueOf(value)); err != nil {
+			fieldErrors = append(fieldErrors, FieldError{rule.field, "type", err.Error()})
+			continue
+		}
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			v = v.Elem()
+		}
+
+		if fe := rule.checkRange(v); fe != nil {
+			fieldErrors = append(fieldErrors, *fe)
+		}
+		if fe := rule.checkPattern(v); fe != nil {
+			fieldErrors = append(fieldErrors, *fe)
+		}
+	}
+
+	return fieldErrors
+}
+
+func (rule *fieldRule) checkRange(v reflect.Value) *FieldError {
+	if rule.min == nil && rule.max == nil {
+		return nil
+	}
+
+	var f float64
+	var what string
+	switch {
+	case v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64:
+		f, what = float64(v.Int()), "value"
+	case v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uintptr:
+		f, what = float64(v.Uint()), "value"
+	case v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64:
+		f, what = v.Float(), "value"
+	case v.Kind() == reflect.String || v.Kind() == reflect.Slice || v.Kind() == reflect.Map || v.Kind() == reflect.Array:
+		f, what = float64(v.Len()), "length"
+	default:
+		return nil
+	}
+
+	if rule.min != nil && f < *rule.min {
+		return &FieldError{rule.field, "min", fmt.Sprintf("%s %v is less than %v", what, f, *rule.min)}
+	}
+	if rule.max != nil && f > *rule.max {
+		return &FieldError{rule.field, "max", fmt.Sprintf("%s %v is greater than %v", what, f, *rule.max)}
+	}
+	return nil
+}
+
+func (rule *fieldRule) checkPattern(v reflect.Value) *FieldError {
+	if rule.pattern == nil {
+		return nil
+	}
+
+	var strs []string
+	switch {
+	case v.Kind() == reflect.String:
+		strs = []string{v.String()}
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		for i := 0; i < v.Len(); i++ {
+			strs = append(strs, v.Index(i).String())
+		}
+	}
+
+	for _, s := range strs {
+		if !rule.pattern.MatchString(s) {
+			return &FieldError{rule.field, "pattern", fmt.Sprintf("%q doesn't match %s", s, rule.pattern)}
+		}
+	}
+	return nil
+}
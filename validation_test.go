@@ -0,0 +1,35 @@
+package spy
+
+import (
+	"reflect"
+	"testing"
+)
+
+type stockItem struct {
+	SKU   string  `spy:"sku,required"`
+	Stock int     `spy:"stock,required"`
+	Price float64 `spy:"price,min=1"`
+}
+
+func TestStructItemSchemaZeroValuesAreMissing(t *testing.T) {
+	schema, err := NewStructItemSchema(stockItem{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, item := range []interface{}{&stockItem{}, &Item{"sku": "", "stock": 0, "price": 0.0}} {
+		adapter, err := NewItemAdapter(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []FieldError{{"sku", "required", "missing value"}, {"stock", "required", "missing value"}}
+		if got := schema.Validate(adapter); !reflect.DeepEqual(got, want) {
+			t.Errorf("Validate(%v) = %v, want %v", item, got, want)
+		}
+	}
+
+	adapter, _ := NewItemAdapter(&stockItem{SKU: "A-1", Stock: 3, Price: 0.5})
+	if got := schema.Validate(adapter); len(got) != 1 || got[0].Field != "price" {
+		t.Errorf("Validate = %v, want a price error", got)
+	}
+}
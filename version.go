@@ -0,0 +1,3 @@
+package spy
+
+const Version = "0.1.0"
@@ -0,0 +1,225 @@
+package spy
+
+import (
+	"github.com/andybalholm/cascadia"
+	"github.com/antchfx/xmlquery"
+	"github.com/antchfx/xpath"
+	"golang.org/x/net/html"
+	"strings"
+)
+
+// xmlDocument holds the state shared by all the selectors of one XML document.
+type xmlDocument struct {
+	root       *xmlquery.Node
+	namespaces map[string]string // prefix -> namespace URI
+
+	// CSS selectors are matched against an HTML mirror of the XML tree,
+	// built lazily on the first CSS query.
+	htmlNodes map[*xmlquery.Node]*html.Node
+	xmlNodes  map[*html.Node]*xmlquery.Node
+}
+
+// XMLSelector selects nodes of an XML document with CSS or XPath queries.
+type XMLSelector struct {
+	node *xmlquery.Node
+	doc  *xmlDocument
+}
+
+func NewXMLSelector(root *xmlquery.Node) *XMLSelector {
+	return &XMLSelector{
+		node: root,
+		doc: &xmlDocument{
+			root:       root,
+			namespaces: make(map[string]string),
+		},
+	}
+}
+
+// RegisterNamespace registers a namespace to be used in XPath queries.
+// The prefix need not be the one used in the document, which allows to query
+// elements of a default namespace, e.g., the sitemap one.
+// Registered namespaces are shared by all the selectors of the document.
+func (xs *XMLSelector) RegisterNamespace(prefix, uri string) {
+	xs.doc.namespaces[prefix] = uri
+}
+
+// RemoveNamespaces removes all namespaces of the document,
+// so that elements and attributes can be queried by their local names only.
+func (xs *XMLSelector) RemoveNamespaces() {
+	removeNamespaces(xs.doc.root)
+	xs.doc.htmlNodes = nil // mirror is stale
+	xs.doc.xmlNodes = nil
+}
+
+func removeNamespaces(node *xmlquery.Node) {
+	if node.Type == xmlquery.ElementNode {
+		node.Prefix = ""
+		node.NamespaceURI = ""
+
+		attrs := node.Attr[:0]
+		for _, attr := range node.Attr {
+			if attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+				continue // drop namespace declarations
+			}
+			attr.Name.Space = ""
+			attr.NamespaceURI = ""
+			attrs = append(attrs, attr)
+		}
+		node.Attr = attrs
+	}
+
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		removeNamespaces(child)
+	}
+}
+
+func (xs *XMLSelector) Select(query string) Selectors {
+	css, pseudo, attrName := splitPseudoElement(query)
+
+	var selected []*XMLSelector
+	if css == "" {
+		selected = []*XMLSelector{xs}
+	} else {
+		selected = xs.selectCSS(css)
+	}
+
+	var result Selectors
+	for _, s := range selected {
+		switch pseudo {
+		case "text":
+			for c := s.node.FirstChild; c != nil; c = c.NextSibling {
+				if c.Type == xmlquery.TextNode || c.Type == xmlquery.CharDataNode {
+					result = append(result, TextSelector(c.Data))
+				}
+			}
+		case "attr":
+			if val, exists := s.Attr(attrName); exists {
+				result = append(result, TextSelector(val))
+			}
+		default:
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func (xs *XMLSelector) selectCSS(css string) []*XMLSelector {
+	sel := cascadia.MustCompile(css)
+
+	xs.doc.buildMirror()
+	node := xs.doc.htmlNodes[xs.node]
+	if node == nil {
+		return nil // not an element or document, e.g., text
+	}
+
+	var result []*XMLSelector
+	for c := node.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		for _, n := range sel.MatchAll(c) {
+			result = append(result, &XMLSelector{xs.doc.xmlNodes[n], xs.doc})
+		}
+	}
+	return result
+}
+
+func (xs *XMLSelector) XPath(query string) Selectors {
+	expr, err := xpath.CompileWithNS(query, xs.doc.namespaces)
+	if err != nil {
+		panic("invalid xpath '" + query + "': " + err.Error())
+	}
+
+	nodes := xmlquery.QuerySelectorAll(xs.node, expr)
+	var result = make(Selectors, len(nodes))
+	for i, n := range nodes {
+		result[i] = &XMLSelector{n, xs.doc}
+	}
+	return result
+}
+
+func (xs *XMLSelector) Regex(regex interface{}) []string {
+	return regexExtract(getRegex(regex), xs.Extract())
+}
+
+func (xs *XMLSelector) Extract() string {
+	return xs.node.InnerText()
+}
+
+// ExtractHTML returns the markup of the children of the node.
+func (xs *XMLSelector) ExtractHTML() string {
+	var buf strings.Builder
+	for c := xs.node.FirstChild; c != nil; c = c.NextSibling {
+		buf.WriteString(c.OutputXML(true))
+	}
+	return buf.String()
+}
+
+// ExtractOuterHTML returns the markup of the node.
+func (xs *XMLSelector) ExtractOuterHTML() string {
+	return xs.node.OutputXML(true)
+}
+
+func (xs *XMLSelector) Attr(attrName string) (val string, exists bool) {
+	if xs.node.Type == xmlquery.AttributeNode {
+		if xs.node.Data == attrName {
+			return xs.node.InnerText(), true
+		}
+		return "", false
+	}
+
+	for _, attr := range xs.node.Attr {
+		name := attr.Name.Local
+		if attr.Name.Space != "" {
+			name = attr.Name.Space + ":" + name
+		}
+		if name == attrName {
+			return attr.Value, true
+		}
+	}
+	return "", false
+}
+
+// buildMirror builds an HTML tree with the same shape as the XML tree,
+// so that CSS selectors, which only work on HTML nodes, can be used.
+// Element and attribute names are lowercased, the way CSS queries are.
+func (doc *xmlDocument) buildMirror() {
+	if doc.htmlNodes != nil {
+		return
+	}
+	doc.htmlNodes = make(map[*xmlquery.Node]*html.Node)
+	doc.xmlNodes = make(map[*html.Node]*xmlquery.Node)
+	doc.mirror(doc.root)
+}
+
+func (doc *xmlDocument) mirror(node *xmlquery.Node) *html.Node {
+	var n *html.Node
+	switch node.Type {
+	case xmlquery.DocumentNode:
+		n = &html.Node{Type: html.DocumentNode}
+	case xmlquery.ElementNode:
+		n = &html.Node{Type: html.ElementNode, Data: strings.ToLower(node.Data)}
+		for _, attr := range node.Attr {
+			n.Attr = append(n.Attr, html.Attribute{
+				Key: strings.ToLower(attr.Name.Local),
+				Val: attr.Value,
+			})
+		}
+	case xmlquery.TextNode, xmlquery.CharDataNode:
+		n = &html.Node{Type: html.TextNode, Data: node.Data}
+	case xmlquery.CommentNode:
+		n = &html.Node{Type: html.CommentNode, Data: node.Data}
+	default:
+		return nil
+	}
+
+	doc.htmlNodes[node] = n
+	doc.xmlNodes[n] = node
+
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if c := doc.mirror(child); c != nil {
+			n.AppendChild(c)
+		}
+	}
+	return n
+}
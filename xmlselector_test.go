@@ -0,0 +1,83 @@
+package spy
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// newTestResponse returns a response of the body, parsed according to the content type.
+func newTestResponse(t *testing.T, contentType, body string) *Response {
+	t.Helper()
+	request := NewRequest("http://example.test/", http.MethodGet)
+	response, err := NewResponse(&http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {contentType}},
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte(body))),
+		Request:    request.Request,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Request = request
+	return response
+}
+
+const testSitemap = `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9" xmlns:image="http://www.google.com/schemas/sitemap-image/1.1">
+  <url>
+    <loc>http://example.test/a</loc>
+    <image:image><image:loc>http://example.test/a.png</image:loc></image:image>
+  </url>
+  <url priority="high"><loc>http://example.test/b</loc></url>
+</urlset>`
+
+func TestXMLSelectorNamespaces(t *testing.T) {
+	response := newTestResponse(t, "application/xml", testSitemap)
+	selector, ok := response.Selector().(*XMLSelector)
+	if !ok {
+		t.Fatalf("Selector() = %T, want *XMLSelector", response.Selector())
+	}
+
+	// the default namespace is queried with any registered prefix
+	selector.RegisterNamespace("sm", "http://www.sitemaps.org/schemas/sitemap/0.9")
+	selector.RegisterNamespace("img", "http://www.google.com/schemas/sitemap-image/1.1")
+	want := []string{"http://example.test/a", "http://example.test/b"}
+	if got := response.XPath("//sm:url/sm:loc").Extract(); !reflect.DeepEqual(got, want) {
+		t.Errorf("XPath(//sm:url/sm:loc) = %q, want %q", got, want)
+	}
+	if got := response.XPath("//img:loc").ExtractFirst(); got != "http://example.test/a.png" {
+		t.Errorf("XPath(//img:loc) = %q, want the image", got)
+	}
+
+	selector.RemoveNamespaces()
+	if got := response.XPath("//url/loc").Extract(); !reflect.DeepEqual(got, want) {
+		t.Errorf("XPath(//url/loc) without namespaces = %q, want %q", got, want)
+	}
+	if got := response.XPath("//image/loc").ExtractFirst(); got != "http://example.test/a.png" {
+		t.Errorf("XPath(//image/loc) without namespaces = %q, want the image", got)
+	}
+}
+
+func TestXMLSelectorCSS(t *testing.T) {
+	response := newTestResponse(t, "application/xml", testSitemap)
+	response.Selector().(*XMLSelector).RemoveNamespaces()
+
+	if got := response.Select("url > loc::text").Extract(); !reflect.DeepEqual(got, []string{"http://example.test/a", "http://example.test/b"}) {
+		t.Errorf("Select(url > loc::text) = %q", got)
+	}
+	if got := response.Select("url::attr(priority)").Extract(); !reflect.DeepEqual(got, []string{"high"}) {
+		t.Errorf("Select(url::attr(priority)) = %q, want [high]", got)
+	}
+
+	// CSS and XPath compose, relative to the selected nodes
+	urls := response.Select("url")
+	if got := urls.XPath("./loc").Extract(); len(got) != 2 {
+		t.Errorf("Select(url).XPath(./loc) = %q, want 2 locations", got)
+	}
+	if got := urls.Select("image loc").Extract(); !reflect.DeepEqual(got, []string{"http://example.test/a.png"}) {
+		t.Errorf("Select(url).Select(image loc) = %q", got)
+	}
+}